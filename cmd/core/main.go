@@ -4,21 +4,35 @@ import (
 	"ultraphx-core/internal/hub"
 	"ultraphx-core/internal/modules"
 	"ultraphx-core/internal/servers"
+	"ultraphx-core/internal/services/ingest"
+	"ultraphx-core/internal/services/journal"
+	"ultraphx-core/internal/services/sensor"
 )
 
 func Bootstrap() {
 	h := hub.NewHub()
 	go h.Run()
 
+	// Start message journal
+	journal.Setup(h)
+
+	// Load MQTT ingest mappings
+	ingest.Setup()
+
 	// Start all modules
 	modules.Setup(h)
 
+	// Start background sensor discovery
+	sensor.Setup(h)
+
 	// Start all servers
 	servers.SetupWs(h)
 	servers.SetupHttp(h)
+	servers.SetupMqtt(h)
 
 	go servers.ServeHTTP(h)
 	go servers.ServeMQTT(h)
+	go servers.ServeCoAP(h)
 
 	// Block forever
 	select {}
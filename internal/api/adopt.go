@@ -0,0 +1,161 @@
+package api
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/services/sensor"
+	"ultraphx-core/pkg/resp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// 收编设备的默认采集周期，单位为秒
+const defaultAdoptPeriod = 60
+
+var (
+	errDeviceNotFound   = errors.New("device not found in discovered devices")
+	errDeviceRegistered = errors.New("device is already registered")
+	errNoEndpoint       = errors.New("device has no collectable endpoint")
+)
+
+// 串行化收编，避免并发请求在检查已登记的 IP 后重复登记同一设备
+var adoptMu sync.Mutex
+
+type adoptRequest struct {
+	ID               string `json:"id"`               // 扫描结果中的设备 ID
+	Endpoint         string `json:"endpoint"`         // 端点路径，为空时使用第一个可采集的端点
+	Name             string `json:"name"`             // 传感器名称，为空时使用设备名称
+	CollectionPeriod int    `json:"collectionPeriod"` // 采集周期，单位为秒
+}
+
+type adoptResult struct {
+	ID     string         `json:"id"`
+	Client *models.Client `json:"client,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// endpointDataType 将端点类型转换为采集数据类型，不支持的类型返回 false
+func endpointDataType(endpoint sensor.Entrypoint) (models.CollectionDataType, bool) {
+	if endpoint.Method != "" && !strings.EqualFold(endpoint.Method, "GET") {
+		return "", false
+	}
+	switch strings.ToLower(endpoint.Type) {
+	case "json", "":
+		return models.CollectionDataTypeJSON, true
+	case "metrics", "prometheus", "openmetrics":
+		return models.CollectionDataTypeMetrics, true
+	}
+	return "", false
+}
+
+// selectEndpoint 选择指定路径的端点，未指定时选择第一个可采集的端点
+func selectEndpoint(device sensor.Device, path string) (sensor.Entrypoint, models.CollectionDataType, error) {
+	for _, endpoint := range device.Endpoints {
+		if path != "" && endpoint.Path != path {
+			continue
+		}
+		if dataType, ok := endpointDataType(endpoint); ok {
+			return endpoint, dataType, nil
+		}
+	}
+	return sensor.Entrypoint{}, "", errNoEndpoint
+}
+
+// adoptDevice 将扫描到的设备登记为主动传感器，registered 为已登记的 IP，成功后会加入该设备
+func adoptDevice(req adoptRequest, registered map[string]bool) (*models.Client, error) {
+	device, ok := sensor.GetDevice(req.ID)
+	if !ok {
+		return nil, errDeviceNotFound
+	}
+	if registered[device.IP] {
+		return nil, errDeviceRegistered
+	}
+	endpoint, dataType, err := selectEndpoint(device, req.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	name := req.Name
+	if name == "" {
+		name = device.Name
+	}
+	period := req.CollectionPeriod
+	if period <= 0 {
+		period = defaultAdoptPeriod
+	}
+
+	client := models.Client{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: device.Description,
+		Type:        models.ClientTypeSensorActive,
+		Status:      models.ClientStatusActive,
+	}
+	collectionInfo := models.CollectionInfo{
+		ClientID:           client.ID,
+		DataType:           dataType,
+		CollectionPeriod:   period,
+		IPAddress:          device.IP,
+		CollectionEndpoint: device.URL(endpoint.Path),
+	}
+	if err := createActiveSensor(&client, &collectionInfo); err != nil {
+		return nil, err
+	}
+	client.Collection = &collectionInfo
+	registered[device.IP] = true
+	return &client, nil
+}
+
+// 将扫描到的设备收编为主动传感器
+func AdoptSensor(c *gin.Context) {
+	var req adoptRequest
+	if err := c.ShouldBind(&req); err != nil || req.ID == "" {
+		resp.Error(c, "Invalid request")
+		return
+	}
+
+	adoptMu.Lock()
+	client, err := adoptDevice(req, sensor.RegisteredIPs())
+	adoptMu.Unlock()
+	if err != nil {
+		logrus.WithError(err).WithField("device", req.ID).Warn("Failed to adopt device")
+		resp.Error(c, err.Error())
+		return
+	}
+	resp.OK(c, client)
+}
+
+// 批量收编设备，每个设备单独返回结果，未指定采集周期的设备使用请求中的 collectionPeriod
+func AdoptSensors(c *gin.Context) {
+	var req struct {
+		Devices          []adoptRequest `json:"devices"`
+		CollectionPeriod int            `json:"collectionPeriod"`
+	}
+	if err := c.ShouldBind(&req); err != nil || len(req.Devices) == 0 {
+		resp.Error(c, "Invalid request")
+		return
+	}
+
+	adoptMu.Lock()
+	defer adoptMu.Unlock()
+	registered := sensor.RegisteredIPs()
+	results := make([]adoptResult, 0, len(req.Devices))
+	for _, device := range req.Devices {
+		if device.CollectionPeriod <= 0 {
+			device.CollectionPeriod = req.CollectionPeriod
+		}
+		result := adoptResult{ID: device.ID}
+		client, err := adoptDevice(device, registered)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Client = client
+		}
+		results = append(results, result)
+	}
+	resp.OK(c, results)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/services/sensor"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scanTestDevice 启动提供 /metadata 的设备并扫描，返回扫描结果中的设备
+func scanTestDevice(t *testing.T) sensor.Device {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"metadata": {"name": "thermo"}, "entrypoints": [{"path": "/data/json", "method": "GET", "type": "json"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	job, err := sensor.StartScan(sensor.ScanOptions{CIDRs: []string{host}, Ports: []int{portNum}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := job.Wait()
+	if len(devices) != 1 {
+		t.Fatalf("scan found %d devices, want 1", len(devices))
+	}
+	return devices[0]
+}
+
+func postJSON(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler(c)
+	return w
+}
+
+func TestConcurrentAdoptRegistersOnce(t *testing.T) {
+	device := scanTestDevice(t)
+	t.Cleanup(func() {
+		var infos []models.CollectionInfo
+		(&models.CollectionInfo{}).Query().Where("ip_address = ?", device.IP).Find(&infos)
+		for _, info := range infos {
+			(&models.Client{}).Query().Where("id = ?", info.ClientID).Delete(&models.Client{})
+			(&models.CollectionInfo{}).Query().Where("client_id = ?", info.ClientID).Delete(&models.CollectionInfo{})
+		}
+	})
+	single := `{"id": "` + device.ID + `"}`
+	bulk := `{"devices": [{"id": "` + device.ID + `"}, {"id": "` + device.ID + `"}]}`
+
+	const n = 32
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	adopted := 0
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			if w := postJSON(AdoptSensor, single); w.Code == http.StatusOK {
+				mu.Lock()
+				adopted++
+				mu.Unlock()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			w := postJSON(AdoptSensors, bulk)
+			var body struct {
+				Data []adoptResult `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			for _, result := range body.Data {
+				if result.Client != nil {
+					mu.Lock()
+					adopted++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if adopted != 1 {
+		t.Errorf("device adopted %d times, want 1", adopted)
+	}
+	var count int64
+	(&models.CollectionInfo{}).Query().Where("ip_address = ?", device.IP).Count(&count)
+	if count != 1 {
+		t.Errorf("%d collection records for %s, want 1", count, device.IP)
+	}
+}
@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/modules/collect"
 	"ultraphx-core/internal/services/auth"
 	"ultraphx-core/internal/services/sensor"
 	"ultraphx-core/pkg/resp"
@@ -133,6 +136,12 @@ func AddActiveSensor(c *gin.Context) {
 			CollectionEndpoint string                    `json:"collectionEndpoint" validate:"required"`
 			AuthToken          string                    `json:"authToken"`
 			CustomLabels       string                    `json:"customLabels"`
+			UnitID             uint8                     `json:"unitId"`
+			Registers          []models.ModbusRegister   `json:"registers"`
+			MetricAllow        []string                  `json:"metricAllow"`
+			MetricDeny         []string                  `json:"metricDeny"`
+			Fields             []models.CollectionField  `json:"fields"`
+			LabelFields        []models.CollectionLabel  `json:"labelFields"`
 		}
 	}
 
@@ -157,25 +166,43 @@ func AddActiveSensor(c *gin.Context) {
 		CollectionEndpoint: req.CollectionInfo.CollectionEndpoint,
 		AuthToken:          req.CollectionInfo.AuthToken,
 		CustomLabels:       req.CollectionInfo.CustomLabels,
+		UnitID:             req.CollectionInfo.UnitID,
+		Registers:          req.CollectionInfo.Registers,
+		MetricAllow:        req.CollectionInfo.MetricAllow,
+		MetricDeny:         req.CollectionInfo.MetricDeny,
+		Fields:             req.CollectionInfo.Fields,
+		LabelFields:        req.CollectionInfo.LabelFields,
+	}
+	if err := collect.Validate(&collectionInfo); err != nil {
+		resp.Error(c, err.Error())
+		return
 	}
 
+	if err := createActiveSensor(&client, &collectionInfo); err != nil {
+		logrus.WithError(err).Error("Failed to create client")
+		resp.Error(c, "Failed to create client")
+		return
+	}
+
+	resp.OK(c, client)
+}
+
+// createActiveSensor 保存主动传感器及其采集配置并开始采集
+func createActiveSensor(client *models.Client, collectionInfo *models.CollectionInfo) error {
 	err := models.DB.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&client).Error; err != nil {
+		if err := tx.Create(client).Error; err != nil {
 			return err
 		}
-		if err := tx.Create(&collectionInfo).Error; err != nil {
+		if err := tx.Create(collectionInfo).Error; err != nil {
 			return err
 		}
 		return nil
 	})
-
 	if err != nil {
-		logrus.WithError(err).Error("Failed to create client")
-		resp.Error(c, "Failed to create client")
-		return
+		return err
 	}
-
-	resp.OK(c, client)
+	collect.Refresh(client.ID)
+	return nil
 }
 
 func RemoveClient(c *gin.Context) {
@@ -211,6 +238,7 @@ func RemoveClient(c *gin.Context) {
 		resp.Error(c, "Failed to remove client")
 		return
 	}
+	collect.Refresh(client.ID)
 
 	resp.OK(c, client)
 }
@@ -240,15 +268,112 @@ func SetClientStatus(c *gin.Context) {
 		resp.Error(c, "Failed to update client")
 		return
 	}
+	collect.Refresh(client.ID)
 
 	resp.OK(c, client)
 }
 
-// 扫描主动传感器
+// 获取主动传感器的采集状态，指定 clientId 时只返回该客户端
+func GetCollectStatus(c *gin.Context) {
+	clientID := c.Query("clientId")
+	if clientID == "" {
+		resp.OK(c, collect.Statuses())
+		return
+	}
+
+	status, ok := collect.Status(clientID)
+	if !ok {
+		resp.Error(c, "No collection status for client")
+		return
+	}
+	resp.OK(c, status)
+}
+
+// 立即采集一次主动传感器的数据，publish 为 true 时发布到 hub
+func CollectNow(c *gin.Context) {
+	var req struct {
+		ClientID string `json:"clientID" validate:"required"`
+		Publish  bool   `json:"publish"`
+	}
+	if err := c.ShouldBind(&req); err != nil || req.ClientID == "" {
+		resp.Error(c, "Invalid request")
+		return
+	}
+
+	result, err := collect.CollectNow(req.ClientID, req.Publish)
+	if err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	resp.OK(c, result)
+}
+
+// 使用尚未保存的采集配置测试连接，不发布数据
+func TestCollection(c *gin.Context) {
+	var req models.CollectionInfo
+	if err := c.ShouldBindJSON(&req); err != nil || req.DataType == "" || req.CollectionEndpoint == "" {
+		resp.Error(c, "Invalid request")
+		return
+	}
+
+	resp.OK(c, collect.Test(&req))
+}
+
+// 扫描主动传感器，使用默认参数创建扫描任务并立即返回任务状态，结果通过扫描任务获取
 func ScanActiveSensor(c *gin.Context) {
-	// 在本地网络中搜索
-	devices := sensor.ScanSensors()
-	resp.OK(c, devices)
+	job, err := sensor.StartScan(sensor.ScanOptions{})
+	if err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	resp.OK(c, job.Status())
+}
+
+// 获取当前通过 mDNS 发现的设备，返回的 ID 可用于收编
+func GetDiscoveredDevices(c *gin.Context) {
+	resp.OK(c, sensor.DiscoveredDevices())
+}
+
+// 获取全部扫描任务
+func GetScanJobs(c *gin.Context) {
+	resp.OK(c, sensor.ScanJobs())
+}
+
+// 创建扫描任务，立即返回任务状态，进度可以轮询任务或订阅 sensor::scan::<任务 ID>
+func StartScanJob(c *gin.Context) {
+	var opts sensor.ScanOptions
+	if err := c.ShouldBindJSON(&opts); err != nil && !errors.Is(err, io.EOF) {
+		resp.Error(c, "Invalid request")
+		return
+	}
+
+	job, err := sensor.StartScan(opts)
+	if err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	resp.OK(c, job.Status())
+}
+
+// 获取扫描任务的进度与结果
+func GetScanJob(c *gin.Context) {
+	job, ok := sensor.GetScanJob(c.Query("id"))
+	if !ok {
+		resp.Error(c, "Scan job not found")
+		return
+	}
+	resp.OK(c, job.Status())
+}
+
+// 取消扫描任务
+func CancelScanJob(c *gin.Context) {
+	job, ok := sensor.GetScanJob(c.Query("id"))
+	if !ok {
+		resp.Error(c, "Scan job not found")
+		return
+	}
+	job.Cancel()
+	resp.OK(c, nil)
 }
 
 // 初始化本地客户端
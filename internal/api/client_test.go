@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dir, err := os.MkdirTemp("", "api-test")
+	if err != nil {
+		panic(err)
+	}
+	config.GetDataBaseConfig().File = filepath.Join(dir, "database.db")
+	models.Setup()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	// config 与 auth 包初始化时在当前目录生成的配置文件与密钥
+	os.RemoveAll("config")
+	os.Exit(code)
+}
+
+func TestAddActiveSensorRejectsInvalidModbus(t *testing.T) {
+	tests := []struct {
+		name      string
+		registers string
+	}{
+		{"no registers", `[]`},
+		{"missing registers", `null`},
+		{"empty metric", `[{"address": 0, "metric": "temperature"}, {"address": 1, "metric": ""}]`},
+	}
+	for _, tt := range tests {
+		body := `{"name": "plc", "collectionInfo": {"dataType": "modbus", "collectionPeriod": 10,
+			"ipAddress": "192.168.1.10", "collectionEndpoint": "192.168.1.10:502", "registers": ` + tt.registers + `}}`
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/client/add_active_sensor", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		AddActiveSensor(c)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want %d (%s)", tt.name, w.Code, http.StatusBadRequest, w.Body.String())
+		}
+	}
+}
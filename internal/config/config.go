@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -11,6 +12,12 @@ type Config struct {
 	Server   ServerConfig
 	VmDB     VmDBConfig
 	DataBase DataBaseConfig
+	Mqtt     MqttConfig
+	Coap     CoapConfig
+	Hub      HubConfig
+	Journal  JournalConfig
+	Collect  CollectConfig
+	Sensor   SensorConfig
 }
 
 type DataBaseConfig struct {
@@ -21,6 +28,104 @@ type VmDBConfig struct {
 	Url string
 }
 
+type MqttConfig struct {
+	// 是否启动内置 MQTT Broker
+	Enabled bool
+	// 内置 MQTT Broker 的监听端口
+	Port string
+	// 来自 MQTT 桥接的消息所拥有的权限，例如 data::#-w
+	Permissions []string
+	// 需要桥接的外部 MQTT Broker
+	Bridges []MqttBridgeConfig
+}
+
+type MqttBridgeConfig struct {
+	Name string
+	// Broker 地址，例如 tcp://mosquitto:1883、ssl://mosquitto:8883
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// TLS 证书文件路径
+	CACert             string
+	ClientCert         string
+	ClientKey          string
+	InsecureSkipVerify bool
+	QoS                byte
+	// 重连间隔，连接失败后从最小值开始翻倍直到最大值
+	MinReconnectInterval time.Duration
+	MaxReconnectInterval time.Duration
+	// 从外部 Broker 订阅并发布到 hub 的主题
+	In []MqttTopicMapping
+	// 从 hub 转发到外部 Broker 的主题
+	Out []MqttTopicMapping
+}
+
+// MqttTopicMapping 外部 MQTT 主题与 hub 主题的对应关系，两边的通配符按顺序一一对应，
+// 例如 site/+/temperature 对应 data::+::temperature
+type MqttTopicMapping struct {
+	Remote string
+	Local  string
+}
+
+type CoapConfig struct {
+	// 是否启动 CoAP 服务
+	Enabled bool
+	// CoAP 服务的 UDP 监听端口
+	Port string
+}
+
+type HubConfig struct {
+	// 每个客户端的发送队列长度
+	QueueSize int
+	// 客户端连接时通过 queueSize 参数可以申请的最大队列长度
+	MaxQueueSize int
+	// 队列已满时的处理方式：drop-oldest、drop-newest、disconnect
+	OverflowPolicy string
+	// 是否将保留消息保存到数据库
+	PersistRetained bool
+}
+
+type JournalConfig struct {
+	Enabled bool
+	Dir     string
+	// 需要记录的主题
+	Topics []string
+	// 单个分段文件的大小上限，单位为字节
+	SegmentSize int64
+	// 全部分段的大小上限，单位为字节
+	MaxSize int64
+	// 分段保留时间
+	MaxAge time.Duration
+}
+
+type CollectConfig struct {
+	// 同时进行的主动采集数量上限
+	MaxConcurrency int
+	// 对同一主机同时进行的采集数量上限
+	MaxPerHost int
+	// 采集时间的随机抖动上限，实际抖动不超过采集周期的十分之一
+	MaxJitter time.Duration
+	// 上次采集时间与采集状态写回数据库的最小间隔，状态变化时立即写回
+	PersistInterval time.Duration
+	// 连续失败多少次后暂停采集
+	SuspendAfter int
+	// 暂停时长，从最小值开始每次失败翻倍直到最大值
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type SensorConfig struct {
+	// 后台扫描局域网的间隔，为 0 时不进行后台扫描，默认为 0，需要时在配置文件中开启
+	ScanInterval time.Duration
+	// 是否通过 mDNS/DNS-SD 发现设备
+	MdnsEnabled bool
+	// 每轮 mDNS 浏览的间隔
+	MdnsInterval time.Duration
+	// 需要浏览的 DNS-SD 服务类型
+	MdnsServices []string
+}
+
 type ServerConfig struct {
 	HttpPort string
 }
@@ -35,11 +140,39 @@ func init() {
 	viper.SetDefault("server.httpPort", "8080")
 	viper.SetDefault("vmDB.url", "http://localhost:8428")
 	viper.SetDefault("database.file", "./config/database.db")
+	viper.SetDefault("mqtt.enabled", true)
+	viper.SetDefault("mqtt.port", "1883")
+	viper.SetDefault("mqtt.permissions", []string{"data::#-w"})
+	viper.SetDefault("coap.enabled", true)
+	viper.SetDefault("coap.port", "5683")
+	viper.SetDefault("hub.queueSize", 256)
+	viper.SetDefault("hub.maxQueueSize", 4096)
+	viper.SetDefault("hub.overflowPolicy", "drop-oldest")
+	viper.SetDefault("hub.persistRetained", true)
+	viper.SetDefault("journal.enabled", false)
+	viper.SetDefault("journal.dir", "./config/journal")
+	viper.SetDefault("journal.topics", []string{"#"})
+	viper.SetDefault("journal.segmentSize", 16*1024*1024)
+	viper.SetDefault("journal.maxSize", 256*1024*1024)
+	viper.SetDefault("journal.maxAge", "168h")
+	viper.SetDefault("collect.maxConcurrency", 32)
+	viper.SetDefault("collect.maxPerHost", 2)
+	viper.SetDefault("collect.maxJitter", "5s")
+	viper.SetDefault("collect.persistInterval", "5m")
+	viper.SetDefault("collect.suspendAfter", 3)
+	viper.SetDefault("collect.minBackoff", "2m")
+	viper.SetDefault("collect.maxBackoff", "1h")
+	viper.SetDefault("sensor.scanInterval", 0)
+	viper.SetDefault("sensor.mdnsEnabled", true)
+	viper.SetDefault("sensor.mdnsInterval", "1m")
+	viper.SetDefault("sensor.mdnsServices", []string{"_ultraphx._tcp", "_http._tcp"})
 
 	// ENV
 	viper.BindEnv("server.httpPort", "HTTP_PORT")
 	viper.BindEnv("vmDB.url", "VM_DB_URL")
 	viper.BindEnv("database.file", "DATABASE_FILE")
+	viper.BindEnv("mqtt.port", "MQTT_PORT")
+	viper.BindEnv("coap.port", "COAP_PORT")
 
 	if err := os.MkdirAll("./config", 0755); err != nil {
 		panic(err)
@@ -76,3 +209,27 @@ func GetServerConfig() *ServerConfig {
 func GetDataBaseConfig() *DataBaseConfig {
 	return &Cfg.DataBase
 }
+
+func GetMqttConfig() *MqttConfig {
+	return &Cfg.Mqtt
+}
+
+func GetCoapConfig() *CoapConfig {
+	return &Cfg.Coap
+}
+
+func GetHubConfig() *HubConfig {
+	return &Cfg.Hub
+}
+
+func GetJournalConfig() *JournalConfig {
+	return &Cfg.Journal
+}
+
+func GetCollectConfig() *CollectConfig {
+	return &Cfg.Collect
+}
+
+func GetSensorConfig() *SensorConfig {
+	return &Cfg.Sensor
+}
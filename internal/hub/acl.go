@@ -0,0 +1,40 @@
+package hub
+
+import "errors"
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Permission 客户端对某个主题（可含通配符）的读写授权
+type Permission struct {
+	Topic string
+	Type  PermissionType
+}
+
+type Permissions []Permission
+
+// FullPermissions 拥有全部主题的读写权限，用于本地客户端
+var FullPermissions = Permissions{
+	{Topic: "#", Type: PermissionTypeRead},
+	{Topic: "#", Type: PermissionTypeWrite},
+}
+
+// Allowed 判断是否拥有 topic 的 pType 权限
+func (p Permissions) Allowed(topic string, pType PermissionType) bool {
+	for _, permission := range p {
+		if permission.Type != pType {
+			continue
+		}
+		if MatchTopic(permission.Topic, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Permissions) CanRead(topic string) bool {
+	return p.Allowed(topic, PermissionTypeRead)
+}
+
+func (p Permissions) CanWrite(topic string) bool {
+	return p.Allowed(topic, PermissionTypeWrite)
+}
@@ -1,6 +1,11 @@
 package hub
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -12,40 +17,184 @@ const (
 	PermissionTypeWrite
 )
 
+var (
+	ErrClientClosed = errors.New("client closed")
+	ErrQueueFull    = errors.New("client queue is full")
+)
+
+// OverflowPolicy 客户端发送队列已满时的处理方式
+type OverflowPolicy string
+
+const (
+	OverflowDropOldest OverflowPolicy = "drop-oldest" // 丢弃队列中最早的消息
+	OverflowDropNewest OverflowPolicy = "drop-newest" // 丢弃新消息
+	OverflowDisconnect OverflowPolicy = "disconnect"  // 断开客户端
+)
+
+func (p OverflowPolicy) IsValid() bool {
+	switch p {
+	case OverflowDropOldest, OverflowDropNewest, OverflowDisconnect:
+		return true
+	}
+	return false
+}
+
+type ClientOptions struct {
+	QueueSize      int
+	OverflowPolicy OverflowPolicy
+}
+
+var DefaultClientOptions = ClientOptions{
+	QueueSize:      256,
+	OverflowPolicy: OverflowDropOldest,
+}
+
 type Client struct {
-	ID       string
-	SendChan chan *Message
-	Topics   map[string]bool
-	Hub      *Hub
+	ID          string
+	Source      string // 认证后的客户端 ID，作为该客户端所发布消息的来源
+	SendChan    chan *Message
+	Permissions Permissions
+	Hub         *Hub
+
+	policy      OverflowPolicy
+	connectedAt time.Time
+	delivered   atomic.Uint64
+	dropped     atomic.Uint64
+
+	mu     sync.RWMutex
+	topics map[string]bool
+	closed bool
 }
 
 func NewClient(id string, hub *Hub) *Client {
+	return NewClientWithOptions(id, hub, DefaultClientOptions)
+}
+
+func NewClientWithOptions(id string, hub *Hub, opts ClientOptions) *Client {
 	if id == "" {
 		id = uuid.New().String()
 	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultClientOptions.QueueSize
+	}
+	if !opts.OverflowPolicy.IsValid() {
+		opts.OverflowPolicy = DefaultClientOptions.OverflowPolicy
+	}
 	return &Client{
-		ID:       id,
-		SendChan: make(chan *Message),
-		Topics:   make(map[string]bool),
-		Hub:      hub,
+		ID:          id,
+		SendChan:    make(chan *Message, opts.QueueSize),
+		topics:      make(map[string]bool),
+		Hub:         hub,
+		policy:      opts.OverflowPolicy,
+		connectedAt: time.Now(),
+	}
+}
+
+// 向客户端发送消息，队列已满时按照 OverflowPolicy 处理
+func (c *Client) Send(msg *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	select {
+	case c.SendChan <- msg:
+		c.delivered.Add(1)
+		return nil
+	default:
+	}
+
+	switch c.policy {
+	case OverflowDropOldest:
+		select {
+		case <-c.SendChan:
+			c.dropped.Add(1)
+		default:
+		}
+		select {
+		case c.SendChan <- msg:
+			c.delivered.Add(1)
+		default:
+			c.dropped.Add(1)
+		}
+		return nil
+	case OverflowDropNewest:
+		c.dropped.Add(1)
+		return nil
+	default:
+		c.dropped.Add(1)
+		return ErrQueueFull
 	}
 }
 
-// 向客户端发送消息
-func (c *Client) Send(msg *Message) {
-	c.SendChan <- msg
+// close 取消全部订阅并关闭发送通道，可重复调用
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for topic := range c.topics {
+		c.Hub.unsubscribe(c, topic)
+	}
+	c.topics = make(map[string]bool)
+	close(c.SendChan)
 }
 
-// 广播消息
-func (c *Client) Broadcast(msg *Message) {
+func (c *Client) IsClosed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.closed
+}
+
+// 广播消息，需要拥有该主题的写权限
+func (c *Client) Broadcast(msg *Message) error {
+	if err := ValidateTopic(msg.Topic); err != nil {
+		return err
+	}
+	// 响应等待中的请求不需要写权限
+	if !c.Permissions.CanWrite(msg.Topic) && !c.Hub.isPendingReply(msg) {
+		logrus.WithField("client_id", c.ID).WithField("topic", msg.Topic).Warn("Broadcast denied")
+		return ErrPermissionDenied
+	}
 	logrus.WithField("client_id", c.ID).WithField("topic", msg.Topic).Debug("Broadcast message")
-	c.Hub.Broadcast(msg)
+	// 请求只能通过 Request 发起，ResetOrigin 会清除 ReplyTo
+	msg.ResetOrigin(c.Source)
+	return c.Hub.Publish(msg)
 }
 
-func (c *Client) Subscribe(topic string) {
-	c.Topics[topic] = true
+func (c *Client) Subscribe(topic string) error {
+	if err := ValidateTopicFilter(topic); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClientClosed
+	}
+	c.topics[topic] = true
+	c.Hub.subscribe(c, topic)
+	c.mu.Unlock()
+
+	c.sendRetained(topic)
+	return nil
 }
 
 func (c *Client) Unsubscribe(topic string) {
-	delete(c.Topics, topic)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.topics, topic)
+	c.Hub.unsubscribe(c, topic)
+}
+
+// Topics 返回当前订阅的全部主题
+func (c *Client) Topics() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	return topics
 }
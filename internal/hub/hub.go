@@ -1,7 +1,8 @@
 package hub
 
 import (
-	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 )
@@ -10,33 +11,58 @@ var MAX_REGISTER_CHANNEL_SIZE = 100
 var MAX_UNREGISTER_CHANNEL_SIZE = 100
 var MAX_BROADCAST_CHANNEL_SIZE = 100
 
+// 监听器回调由固定数量的 worker 执行
+var MAX_LISTENER_QUEUE_SIZE = 1000
+var MAX_LISTENER_WORKERS = 8
+
 type Hub struct {
-	clientMap  map[string]*Client
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan *Message
+	clientsMu     sync.RWMutex // 写 clientMap 只发生在 Run 所在的 goroutine，其他 goroutine 读取时需要加锁
+	clientMap     map[string]*Client
+	register      chan *Client
+	unregister    chan *Client
+	broadcast     chan *Message
+	listenerQueue chan *Message
+
+	subscriptions *topicTree[*Client]
+	retained      *retainedMessages
+	pending       *pendingRequests
+	journal       Journal
+	validatorMu   sync.RWMutex
+	validator     Validator
+	workersOnce   sync.Once
+	dropped       atomic.Uint64 // 因广播或监听队列已满被丢弃的消息数
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clientMap:  make(map[string]*Client),
-		register:   make(chan *Client, MAX_REGISTER_CHANNEL_SIZE),
-		unregister: make(chan *Client, MAX_UNREGISTER_CHANNEL_SIZE),
-		broadcast:  make(chan *Message, MAX_BROADCAST_CHANNEL_SIZE),
+		clientMap:     make(map[string]*Client),
+		register:      make(chan *Client, MAX_REGISTER_CHANNEL_SIZE),
+		unregister:    make(chan *Client, MAX_UNREGISTER_CHANNEL_SIZE),
+		broadcast:     make(chan *Message, MAX_BROADCAST_CHANNEL_SIZE),
+		listenerQueue: make(chan *Message, MAX_LISTENER_QUEUE_SIZE),
+
+		subscriptions: newTopicTree[*Client](),
+		retained:      newRetainedMessages(),
+		pending:       newPendingRequests(),
 	}
 }
 
 func (h *Hub) Run() {
+	h.workersOnce.Do(func() {
+		for i := 0; i < MAX_LISTENER_WORKERS; i++ {
+			go h.listenerWorker()
+		}
+	})
+
 	logrus.Info("Pub/Sub hub is running")
 	for {
 		select {
 		case client := <-h.register:
+			h.clientsMu.Lock()
 			h.clientMap[client.ID] = client
+			h.clientsMu.Unlock()
 		case client := <-h.unregister:
-			if _, ok := h.clientMap[client.ID]; ok {
-				delete(h.clientMap, client.ID)
-				close(client.SendChan)
-			}
+			h.closeClient(client)
 		case message := <-h.broadcast:
 			logrus.Debug("broadcast message: ", message.ToJson())
 			h.handleBroadcast(message)
@@ -45,45 +71,52 @@ func (h *Hub) Run() {
 }
 
 func (h *Hub) handleBroadcast(message *Message) {
-	for _, client := range h.clientMap {
-		if isValidTopicMatch(message.Topic, client) {
-			select {
-			case client.SendChan <- message:
-			default:
-				h.closeClient(client)
-			}
+	for _, client := range h.subscriptions.Match(message.Topic) {
+		if _, ok := h.clientMap[client.ID]; !ok {
+			continue
+		}
+		if !client.Permissions.CanRead(message.Topic) {
+			continue
+		}
+		if err := client.Send(message); err != nil {
+			logrus.WithError(err).WithField("client_id", client.ID).Warn("Client disconnected")
+			h.closeClient(client)
 		}
 	}
 }
 
-func isValidTopicMatch(topic string, client *Client) bool {
-	if client.Topics["#"] {
-		return true
-	}
+func (h *Hub) subscribe(client *Client, filter string) {
+	h.subscriptions.Add(filter, client)
+}
+
+func (h *Hub) unsubscribe(client *Client, filter string) {
+	h.subscriptions.Remove(filter, client)
+}
 
-	if client.Topics[topic] {
-		return true
+// closeClient 只在 Run 所在的 goroutine 中调用
+func (h *Hub) closeClient(client *Client) {
+	client.close()
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+	if h.clientMap[client.ID] == client {
+		delete(h.clientMap, client.ID)
 	}
+}
 
-	// Check for wildcard subscriptions
-	for subscribedTopic := range client.Topics {
-		if strings.HasSuffix(subscribedTopic, "#") {
-			baseTopic := strings.TrimSuffix(subscribedTopic, "#")
-			if strings.HasPrefix(topic, baseTopic) {
-				return true
-			}
-		}
+func (h *Hub) listenerWorker() {
+	for message := range h.listenerQueue {
+		handleBroadcastListener(h, message)
 	}
+}
 
-	return false
+// Journal 持久化消息日志，Append 需要为记录的消息设置 Offset
+type Journal interface {
+	Append(msg *Message) error
 }
 
-func (h *Hub) closeClient(client *Client) {
-	close(client.SendChan)
-	if !isClosed(client.SendChan) {
-		close(client.SendChan)
-	}
-	delete(h.clientMap, client.ID)
+// SetJournal 设置消息日志，需要在开始广播消息之前调用
+func (h *Hub) SetJournal(journal Journal) {
+	h.journal = journal
 }
 
 func (h *Hub) Register(client *Client) {
@@ -94,29 +127,51 @@ func (h *Hub) Register(client *Client) {
 	}
 }
 
+// Unregister 会阻塞直到 Run 接收，否则客户端无法被关闭
 func (h *Hub) Unregister(client *Client) {
-	select {
-	case h.unregister <- client:
-	default:
-		logrus.Printf("unregister channel is full, client %v discarded", client.ID)
-	}
+	h.unregister <- client
 }
 
+// Broadcast 发布消息，校验失败的消息会被转入死信主题
 func (h *Hub) Broadcast(message *Message) {
-	go handleBroadcastListener(h, message) // not block
-	select {
-	case h.broadcast <- message:
-	default:
-		logrus.Printf("broadcast channel is full, message %v discarded", message)
+	h.Publish(message)
+}
+
+// Publish 校验并发布消息，校验失败时消息被转入死信主题并返回错误
+func (h *Hub) Publish(message *Message) error {
+	message.stamp()
+	if h.deliverReply(message) {
+		return nil
 	}
+	if err := h.validate(message); err != nil {
+		logrus.WithError(err).WithField("topic", message.Topic).Warn("Message rejected")
+		h.deadLetter(message, err)
+		return err
+	}
+	h.dispatch(message)
+	return nil
 }
 
-func isClosed(ch <-chan *Message) bool {
+// dispatch 记录并分发消息
+func (h *Hub) dispatch(message *Message) {
+	if h.journal != nil {
+		if err := h.journal.Append(message); err != nil {
+			logrus.WithError(err).WithField("topic", message.Topic).Error("Failed to append message to journal")
+		}
+	}
+	if message.Retain {
+		h.retain(message)
+	}
 	select {
-	case <-ch:
-		return true
+	case h.listenerQueue <- message:
 	default:
+		h.dropped.Add(1)
+		logrus.Printf("listener queue is full, message %v discarded", message)
+	}
+	select {
+	case h.broadcast <- message:
+	default:
+		h.dropped.Add(1)
+		logrus.Printf("broadcast channel is full, message %v discarded", message)
 	}
-
-	return false
 }
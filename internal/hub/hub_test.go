@@ -0,0 +1,242 @@
+package hub
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 以下测试需要配合 go test -race 运行
+
+func newRunningHub() *Hub {
+	h := NewHub()
+	go h.Run()
+	return h
+}
+
+func newTestClient(h *Hub, id string) *Client {
+	client := NewClientWithOptions(id, h, ClientOptions{QueueSize: 16, OverflowPolicy: OverflowDropOldest})
+	client.Permissions = FullPermissions
+	h.Register(client)
+	waitFor(func() bool {
+		h.clientsMu.RLock()
+		defer h.clientsMu.RUnlock()
+		return h.clientMap[id] == client
+	})
+	return client
+}
+
+// drain 持续读取客户端的发送队列直到通道被关闭
+func drain(client *Client) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range client.SendChan {
+		}
+	}()
+	return done
+}
+
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestConcurrentTopicListeners(t *testing.T) {
+	h := newRunningHub()
+	var calls atomic.Int64
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			topic := fmt.Sprintf("race::listener::%d", i)
+			for j := 0; j < 100; j++ {
+				id := AddTopicListener(topic, func(h *Hub, msg *Message) {
+					calls.Add(1)
+				})
+				RemoveTopicListener(topic, id)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Broadcast(&Message{Topic: fmt.Sprintf("race::listener::%d", i)})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	id := AddTopicListener("race::listener::+", func(h *Hub, msg *Message) {
+		calls.Add(1)
+	})
+	defer RemoveTopicListener("race::listener::+", id)
+	before := calls.Load()
+	h.Broadcast(&Message{Topic: "race::listener::0"})
+	if !waitFor(func() bool { return calls.Load() > before }) {
+		t.Error("listener added after concurrent changes was not called")
+	}
+
+	listenerMu.Lock()
+	defer listenerMu.Unlock()
+	if len(listenerIndex) == 0 {
+		t.Error("listener index lost the remaining listener")
+	}
+	if matched := registeredListeners.Match("race::listener::0"); len(matched) != 1 || matched[0].ID != id {
+		t.Errorf("removed listeners are still registered: %d listeners match", len(matched))
+	}
+}
+
+func TestConcurrentSubscriptions(t *testing.T) {
+	h := newRunningHub()
+	clients := make([]*Client, 4)
+	for i := range clients {
+		clients[i] = newTestClient(h, fmt.Sprintf("sub-%d", i))
+		defer h.Unregister(clients[i])
+		drain(clients[i])
+	}
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *Client) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				topic := fmt.Sprintf("race::sub::%d", j%4)
+				if err := client.Subscribe(topic); err != nil {
+					t.Error(err)
+					return
+				}
+				client.Topics()
+				client.Unsubscribe(topic)
+			}
+		}(client)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 200; j++ {
+			h.Broadcast(&Message{Topic: fmt.Sprintf("race::sub::%d", j%4)})
+			h.Stats()
+		}
+	}()
+	wg.Wait()
+
+	for _, client := range clients {
+		if topics := client.Topics(); len(topics) != 0 {
+			t.Errorf("client %s still subscribed to %v", client.ID, topics)
+		}
+	}
+	if matched := h.subscriptions.Match("race::sub::0"); len(matched) != 0 {
+		t.Errorf("subscription tree still has %d subscribers", len(matched))
+	}
+}
+
+func TestConcurrentBroadcast(t *testing.T) {
+	h := newRunningHub()
+	client := newTestClient(h, "broadcast")
+	if err := client.Subscribe("race::broadcast::#"); err != nil {
+		t.Fatal(err)
+	}
+
+	var received atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range client.SendChan {
+			received.Add(1)
+		}
+	}()
+
+	const publishers, messages = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				msg := &Message{
+					Topic:   fmt.Sprintf("race::broadcast::%d", i),
+					Payload: map[string]interface{}{"n": j},
+				}
+				if err := client.Broadcast(msg); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if !waitFor(func() bool { return received.Load() > 0 && len(h.broadcast) == 0 }) {
+		t.Error("subscriber received no messages")
+	}
+	h.Unregister(client)
+	<-done
+	if n := received.Load(); n > publishers*messages {
+		t.Errorf("received %d messages, published %d", n, publishers*messages)
+	}
+}
+
+func TestConcurrentUnregister(t *testing.T) {
+	h := newRunningHub()
+	client := newTestClient(h, "unregister")
+	if err := client.Subscribe("race::unregister::#"); err != nil {
+		t.Fatal(err)
+	}
+	done := drain(client)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			h.Unregister(client)
+		}()
+		go func() {
+			defer wg.Done()
+			client.close()
+		}()
+		go func() {
+			defer wg.Done()
+			h.Broadcast(&Message{Topic: "race::unregister::a"})
+			client.Send(&Message{Topic: "race::unregister::b"})
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("send channel was not closed")
+	}
+	if !client.IsClosed() {
+		t.Error("client is not closed")
+	}
+	if err := client.Send(&Message{Topic: "race::unregister::c"}); err != ErrClientClosed {
+		t.Errorf("Send after close = %v, want %v", err, ErrClientClosed)
+	}
+	if err := client.Subscribe("race::unregister::#"); err != ErrClientClosed {
+		t.Errorf("Subscribe after close = %v, want %v", err, ErrClientClosed)
+	}
+	if matched := h.subscriptions.Match("race::unregister::a"); len(matched) != 0 {
+		t.Errorf("closed client is still subscribed")
+	}
+	if !waitFor(func() bool {
+		h.clientsMu.RLock()
+		defer h.clientsMu.RUnlock()
+		_, ok := h.clientMap[client.ID]
+		return !ok
+	}) {
+		t.Error("closed client is still registered")
+	}
+}
@@ -1,9 +1,10 @@
 package hub
 
 import (
-	"strings"
+	"sync"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
 type ListenerCallback func(h *Hub, msg *Message)
@@ -14,27 +15,37 @@ type ListenerItem struct {
 	Callback ListenerCallback
 }
 
-var registeredListeners = make(map[string][]*ListenerItem)
+var (
+	listenerMu          sync.Mutex
+	registeredListeners = newTopicTree[*ListenerItem]()
+	listenerIndex       = make(map[string]*ListenerItem)
+)
 
 func AddTopicListener(topic string, callback ListenerCallback) string {
 	id := uuid.New().String()
-	registeredListeners[topic] = append(registeredListeners[topic], &ListenerItem{
+	listener := &ListenerItem{
 		ID:       id,
 		Topic:    topic,
 		Callback: callback,
-	})
+	}
+
+	listenerMu.Lock()
+	defer listenerMu.Unlock()
+	listenerIndex[id] = listener
+	registeredListeners.Add(topic, listener)
 
 	return id
 }
 
 func RemoveTopicListener(topic string, id string) {
-	listeners := registeredListeners[topic]
-	for i, listener := range listeners {
-		if listener.ID == id {
-			registeredListeners[topic] = append(listeners[:i], listeners[i+1:]...)
-			break
-		}
+	listenerMu.Lock()
+	defer listenerMu.Unlock()
+	listener, ok := listenerIndex[id]
+	if !ok || listener.Topic != topic {
+		return
 	}
+	delete(listenerIndex, id)
+	registeredListeners.Remove(topic, listener)
 }
 
 func AddListener(callback ListenerCallback) string {
@@ -46,29 +57,17 @@ func RemoveListener(id string) {
 }
 
 func handleBroadcastListener(h *Hub, msg *Message) {
-	for _, listeners := range registeredListeners {
-		for _, listener := range listeners {
-			if matchesTopic(listener.Topic, msg.Topic) {
-				listener.Callback(h, msg)
-			}
-		}
+	for _, listener := range registeredListeners.Match(msg.Topic) {
+		runListener(h, listener, msg)
 	}
 }
 
-func matchesTopic(listenerTopic, messageTopic string) bool {
-	if listenerTopic == "#" {
-		return true
-	}
-	listenerParts := strings.Split(listenerTopic, "::")
-	messageParts := strings.Split(messageTopic, "::")
-
-	for i, part := range listenerParts {
-		if part == "#" {
-			return true
+// runListener 执行单个回调，回调 panic 不影响 worker
+func runListener(h *Hub, listener *ListenerItem, msg *Message) {
+	defer func() {
+		if err := recover(); err != nil {
+			logrus.WithField("listener", listener.ID).WithField("topic", msg.Topic).Errorf("Listener panic: %v", err)
 		}
-		if i >= len(messageParts) || part != messageParts[i] {
-			return false
-		}
-	}
-	return len(listenerParts) == len(messageParts)
+	}()
+	listener.Callback(h, msg)
 }
@@ -1,10 +1,26 @@
 package hub
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultContentType = "application/json"
 
 type Message struct {
-	Topic   string
-	Payload map[string]interface{}
+	ID            string    // 消息 ID，发布时生成
+	Offset        uint64    // 在消息日志中的偏移量，未记录时为 0
+	Topic         string    // 主题
+	Timestamp     time.Time // 发布时间
+	Source        string    // 发布者客户端 ID，由服务端根据认证信息设置
+	ContentType   string    // 内容类型，默认为 application/json
+	Retain        bool      // 保留消息，新的订阅者会立即收到该主题最后一条保留消息
+	ReplyTo       string    // 请求消息的响应主题
+	CorrelationID string    // 关联请求与响应
+	Headers       map[string]string
+	Payload       map[string]interface{}
 }
 
 func (m *Message) ToJson() []byte {
@@ -12,12 +28,45 @@ func (m *Message) ToJson() []byte {
 	return data
 }
 
+// stamp 补全消息 ID、发布时间与内容类型
+func (m *Message) stamp() {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	if m.ContentType == "" {
+		m.ContentType = DefaultContentType
+	}
+}
+
+// ResetOrigin 重置客户端发布的消息中由服务端决定的字段：来源设为 source，重新生成 ID 与发布时间，
+// 清除日志偏移量与响应主题，客户端提供的这些值不可信
+func (m *Message) ResetOrigin(source string) {
+	m.ID = uuid.New().String()
+	m.Timestamp = time.Now()
+	m.Offset = 0
+	m.Source = source
+	m.ReplyTo = ""
+}
+
+func (m *Message) GetHeader(key string) string {
+	return m.Headers[key]
+}
+
+func (m *Message) SetHeader(key, value string) {
+	if m.Headers == nil {
+		m.Headers = make(map[string]string)
+	}
+	m.Headers[key] = value
+}
+
 func PraseMessageStr(data string) (*Message, error) {
-	msg := &Message{}
-	error := json.Unmarshal([]byte(data), msg)
-	return msg, error
+	return PraseMessageByte([]byte(data))
 }
 
+// PraseMessageByte 解析消息，兼容只包含 Topic 与 Payload 的旧格式
 func PraseMessageByte(data []byte) (*Message, error) {
 	msg := &Message{}
 	error := json.Unmarshal(data, msg)
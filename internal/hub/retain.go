@@ -0,0 +1,120 @@
+package hub
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetainStore 保留消息的持久化存储
+type RetainStore interface {
+	Load() ([]*Message, error)
+	Save(msg *Message) error
+	Delete(topic string) error
+}
+
+// retainedMessages 每个主题保留最后一条标记为 Retain 的消息
+type retainedMessages struct {
+	mu       sync.RWMutex
+	messages map[string]*Message
+	store    RetainStore
+}
+
+func newRetainedMessages() *retainedMessages {
+	return &retainedMessages{
+		messages: make(map[string]*Message),
+	}
+}
+
+// SetRetainStore 设置持久化存储并加载已保存的保留消息
+func (h *Hub) SetRetainStore(store RetainStore) error {
+	messages, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	r := h.retained
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.store = store
+	for _, msg := range messages {
+		r.messages[msg.Topic] = msg
+	}
+	return nil
+}
+
+// retain 保存消息，Payload 为空的保留消息会清除该主题的保留消息
+func (h *Hub) retain(msg *Message) {
+	r := h.retained
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(msg.Payload) == 0 {
+		delete(r.messages, msg.Topic)
+		if r.store != nil {
+			if err := r.store.Delete(msg.Topic); err != nil {
+				logrus.WithError(err).WithField("topic", msg.Topic).Error("Failed to delete retained message")
+			}
+		}
+		return
+	}
+
+	r.messages[msg.Topic] = msg
+	if r.store != nil {
+		if err := r.store.Save(msg); err != nil {
+			logrus.WithError(err).WithField("topic", msg.Topic).Error("Failed to save retained message")
+		}
+	}
+}
+
+// Retained 返回与 filter 匹配的保留消息
+func (h *Hub) Retained(filter string) []*Message {
+	r := h.retained
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := make([]*Message, 0)
+	for topic, msg := range r.messages {
+		if MatchTopic(filter, topic) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// ClearRetained 清除与 filter 匹配且 allowed 返回 true 的保留消息，返回清除的数量，allowed 为 nil 时不做限制
+func (h *Hub) ClearRetained(filter string, allowed func(topic string) bool) int {
+	r := h.retained
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for topic := range r.messages {
+		if !MatchTopic(filter, topic) {
+			continue
+		}
+		if allowed != nil && !allowed(topic) {
+			continue
+		}
+		delete(r.messages, topic)
+		count++
+		if r.store != nil {
+			if err := r.store.Delete(topic); err != nil {
+				logrus.WithError(err).WithField("topic", topic).Error("Failed to delete retained message")
+			}
+		}
+	}
+	return count
+}
+
+// sendRetained 向新订阅的客户端发送匹配的保留消息
+func (c *Client) sendRetained(filter string) {
+	for _, msg := range c.Hub.Retained(filter) {
+		if !c.Permissions.CanRead(msg.Topic) {
+			continue
+		}
+		if err := c.Send(msg); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 请求/响应
+//
+// 请求消息携带 ReplyTo 与 CorrelationID，正常广播给监听器与订阅者；
+// 响应方向 ReplyTo 发布一条 CorrelationID 相同的消息，hub 直接将其交给等待中的请求方，不再广播。
+const (
+	ReplyTopicPrefix = "reply"
+	HeaderError      = "error" // 响应方通过该消息头返回错误
+)
+
+var (
+	DefaultRequestTimeout = 10 * time.Second
+	// MaxRequestTimeout 客户端可以指定的最长请求超时时间
+	MaxRequestTimeout = 60 * time.Second
+)
+
+var (
+	ErrNoReplyTo     = errors.New("message has no reply-to topic")
+	ErrRequestFailed = errors.New("request failed")
+)
+
+type pendingRequests struct {
+	mu       sync.Mutex
+	requests map[string]*pendingRequest
+}
+
+type pendingRequest struct {
+	replyTo string
+	reply   chan *Message
+}
+
+func newPendingRequests() *pendingRequests {
+	return &pendingRequests{
+		requests: make(map[string]*pendingRequest),
+	}
+}
+
+// RequestTimeout 将客户端指定的超时时间（毫秒）转换为请求超时时间，
+// 未指定时使用 DefaultRequestTimeout，超过 MaxRequestTimeout 时使用 MaxRequestTimeout
+func RequestTimeout(ms int) time.Duration {
+	if ms <= 0 {
+		return DefaultRequestTimeout
+	}
+	return min(time.Duration(ms)*time.Millisecond, MaxRequestTimeout)
+}
+
+// Request 发布请求并等待响应
+func (h *Hub) Request(ctx context.Context, topic string, payload map[string]interface{}) (*Message, error) {
+	return h.RequestMessage(ctx, &Message{
+		Topic:   topic,
+		Payload: payload,
+	})
+}
+
+// RequestMessage 发布请求消息并等待响应，ctx 没有截止时间时使用 DefaultRequestTimeout，发布失败时立即返回错误
+func (h *Hub) RequestMessage(ctx context.Context, msg *Message) (*Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+		defer cancel()
+	}
+
+	msg.CorrelationID = uuid.New().String()
+	msg.ReplyTo = ReplyTopicPrefix + TopicSeparator + msg.CorrelationID
+	pending := &pendingRequest{
+		replyTo: msg.ReplyTo,
+		reply:   make(chan *Message, 1),
+	}
+
+	h.pending.mu.Lock()
+	h.pending.requests[msg.CorrelationID] = pending
+	h.pending.mu.Unlock()
+	defer func() {
+		h.pending.mu.Lock()
+		delete(h.pending.requests, msg.CorrelationID)
+		h.pending.mu.Unlock()
+	}()
+
+	// 被校验拒绝的请求不会有响应
+	if err := h.Publish(msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-pending.reply:
+		if errMsg := reply.GetHeader(HeaderError); errMsg != "" {
+			return reply, fmt.Errorf("%w: %s", ErrRequestFailed, errMsg)
+		}
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func isReplyTopic(topic string) bool {
+	return strings.HasPrefix(topic, ReplyTopicPrefix+TopicSeparator)
+}
+
+// Reply 响应请求
+func (h *Hub) Reply(req *Message, payload map[string]interface{}) error {
+	if !isReplyTopic(req.ReplyTo) {
+		return ErrNoReplyTo
+	}
+	h.Broadcast(&Message{
+		Topic:         req.ReplyTo,
+		CorrelationID: req.CorrelationID,
+		Payload:       payload,
+	})
+	return nil
+}
+
+// ReplyError 以错误响应请求
+func (h *Hub) ReplyError(req *Message, err error) error {
+	if !isReplyTopic(req.ReplyTo) {
+		return ErrNoReplyTo
+	}
+	reply := &Message{
+		Topic:         req.ReplyTo,
+		CorrelationID: req.CorrelationID,
+	}
+	reply.SetHeader(HeaderError, err.Error())
+	h.Broadcast(reply)
+	return nil
+}
+
+// isPendingReply 判断消息是否为等待中请求的响应
+func (h *Hub) isPendingReply(msg *Message) bool {
+	if msg.CorrelationID == "" {
+		return false
+	}
+	h.pending.mu.Lock()
+	defer h.pending.mu.Unlock()
+	pending, ok := h.pending.requests[msg.CorrelationID]
+	return ok && pending.replyTo == msg.Topic
+}
+
+// deliverReply 将响应交给等待中的请求方，返回是否已处理
+func (h *Hub) deliverReply(msg *Message) bool {
+	if msg.CorrelationID == "" {
+		return false
+	}
+	h.pending.mu.Lock()
+	defer h.pending.mu.Unlock()
+	pending, ok := h.pending.requests[msg.CorrelationID]
+	if !ok || pending.replyTo != msg.Topic {
+		return false
+	}
+	delete(h.pending.requests, msg.CorrelationID)
+	pending.reply <- msg
+	return true
+}
+
+// Request 以客户端身份发布请求，需要拥有该主题的写权限
+func (c *Client) Request(ctx context.Context, msg *Message) (*Message, error) {
+	if err := ValidateTopic(msg.Topic); err != nil {
+		return nil, err
+	}
+	if !c.Permissions.CanWrite(msg.Topic) {
+		return nil, ErrPermissionDenied
+	}
+	msg.ResetOrigin(c.Source)
+	return c.Hub.RequestMessage(ctx, msg)
+}
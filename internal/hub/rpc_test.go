@@ -0,0 +1,68 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type rejectValidator struct{}
+
+func (rejectValidator) Validate(msg *Message) error {
+	return ErrInvalidPayload
+}
+
+func TestRequestRejectedFailsImmediately(t *testing.T) {
+	h := newRunningHub()
+	h.SetValidator(rejectValidator{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	reply, err := h.Request(ctx, "rpc::rejected", map[string]interface{}{"n": 1})
+	if !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("Request error = %v, want %v", err, ErrInvalidPayload)
+	}
+	if reply != nil {
+		t.Errorf("Request reply = %v, want nil", reply)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Request returned after %s, want immediately", elapsed)
+	}
+}
+
+func TestRequestReply(t *testing.T) {
+	h := newRunningHub()
+	id := AddTopicListener("rpc::echo", func(h *Hub, msg *Message) {
+		h.Reply(msg, msg.Payload)
+	})
+	defer RemoveTopicListener("rpc::echo", id)
+
+	reply, err := h.Request(context.Background(), "rpc::echo", map[string]interface{}{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Payload["n"] != 1 {
+		t.Errorf("reply payload = %v", reply.Payload)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		ms   int
+		want time.Duration
+	}{
+		{0, DefaultRequestTimeout},
+		{-1, DefaultRequestTimeout},
+		{500, 500 * time.Millisecond},
+		{int(MaxRequestTimeout / time.Millisecond), MaxRequestTimeout},
+		{int(MaxRequestTimeout/time.Millisecond) + 1, MaxRequestTimeout},
+		{1 << 30, MaxRequestTimeout},
+	}
+	for _, tt := range tests {
+		if got := RequestTimeout(tt.ms); got != tt.want {
+			t.Errorf("RequestTimeout(%d) = %s, want %s", tt.ms, got, tt.want)
+		}
+	}
+}
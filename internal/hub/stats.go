@@ -0,0 +1,56 @@
+package hub
+
+import "time"
+
+type ClientStats struct {
+	ID             string         `json:"id"`
+	Source         string         `json:"source"`
+	Topics         []string       `json:"topics"`
+	ConnectedAt    time.Time      `json:"connectedAt"`
+	QueueSize      int            `json:"queueSize"`
+	QueueDepth     int            `json:"queueDepth"`
+	OverflowPolicy OverflowPolicy `json:"overflowPolicy"`
+	Delivered      uint64         `json:"delivered"` // 成功放入发送队列的消息数
+	Dropped        uint64         `json:"dropped"`   // 因队列已满被丢弃的消息数
+}
+
+type HubStats struct {
+	Clients         []ClientStats `json:"clients"`
+	BroadcastQueue  int           `json:"broadcastQueue"`
+	ListenerQueue   int           `json:"listenerQueue"`
+	DroppedMessages uint64        `json:"droppedMessages"`
+}
+
+func (c *Client) Stats() ClientStats {
+	return ClientStats{
+		ID:             c.ID,
+		Source:         c.Source,
+		Topics:         c.Topics(),
+		ConnectedAt:    c.connectedAt,
+		QueueSize:      cap(c.SendChan),
+		QueueDepth:     len(c.SendChan),
+		OverflowPolicy: c.policy,
+		Delivered:      c.delivered.Load(),
+		Dropped:        c.dropped.Load(),
+	}
+}
+
+func (h *Hub) Stats() HubStats {
+	h.clientsMu.RLock()
+	clients := make([]*Client, 0, len(h.clientMap))
+	for _, client := range h.clientMap {
+		clients = append(clients, client)
+	}
+	h.clientsMu.RUnlock()
+
+	stats := HubStats{
+		Clients:         make([]ClientStats, 0, len(clients)),
+		BroadcastQueue:  len(h.broadcast),
+		ListenerQueue:   len(h.listenerQueue),
+		DroppedMessages: h.dropped.Load(),
+	}
+	for _, client := range clients {
+		stats.Clients = append(stats.Clients, client.Stats())
+	}
+	return stats
+}
@@ -0,0 +1,181 @@
+package hub
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// 主题由 :: 分隔为多级，订阅时支持两种通配符：
+// 单级通配符 + 匹配任意一级，例如 data::+::temp 匹配 data::s1::temp；
+// 多级通配符 # 匹配剩余的零到多级，只能作为最后一级，例如 data::# 匹配 data、data::s1
+const (
+	TopicSeparator  = "::"
+	TopicWildcardSL = "+"
+	TopicWildcardML = "#"
+)
+
+var (
+	ErrInvalidTopic       = errors.New("invalid topic")
+	ErrInvalidTopicFilter = errors.New("invalid topic filter")
+)
+
+func splitTopic(topic string) []string {
+	return strings.Split(topic, TopicSeparator)
+}
+
+// ValidateTopic 检查发布主题是否合法，发布主题不能包含通配符
+func ValidateTopic(topic string) error {
+	if topic == "" {
+		return ErrInvalidTopic
+	}
+	for _, part := range splitTopic(topic) {
+		if part == "" || strings.ContainsAny(part, TopicWildcardSL+TopicWildcardML) {
+			return ErrInvalidTopic
+		}
+	}
+	return nil
+}
+
+// ValidateTopicFilter 检查订阅主题是否合法，通配符必须独占一级，# 只能作为最后一级
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return ErrInvalidTopicFilter
+	}
+	parts := splitTopic(filter)
+	for i, part := range parts {
+		if part == "" {
+			return ErrInvalidTopicFilter
+		}
+		if strings.Contains(part, TopicWildcardSL) && part != TopicWildcardSL {
+			return ErrInvalidTopicFilter
+		}
+		if strings.Contains(part, TopicWildcardML) && (part != TopicWildcardML || i != len(parts)-1) {
+			return ErrInvalidTopicFilter
+		}
+	}
+	return nil
+}
+
+// MatchTopic 判断主题是否匹配订阅主题
+func MatchTopic(filter, topic string) bool {
+	filterParts := splitTopic(filter)
+	topicParts := splitTopic(topic)
+
+	for i, part := range filterParts {
+		if part == TopicWildcardML {
+			return true
+		}
+		if i >= len(topicParts) {
+			return false
+		}
+		if part != TopicWildcardSL && part != topicParts[i] {
+			return false
+		}
+	}
+	return len(filterParts) == len(topicParts)
+}
+
+// topicTree 按订阅主题逐级存储订阅者，匹配时只访问与消息主题相关的分支
+type topicTree[T comparable] struct {
+	mu   sync.RWMutex
+	root *topicNode[T]
+}
+
+type topicNode[T comparable] struct {
+	children map[string]*topicNode[T]
+	values   map[T]struct{}
+}
+
+func newTopicNode[T comparable]() *topicNode[T] {
+	return &topicNode[T]{
+		children: make(map[string]*topicNode[T]),
+		values:   make(map[T]struct{}),
+	}
+}
+
+func newTopicTree[T comparable]() *topicTree[T] {
+	return &topicTree[T]{root: newTopicNode[T]()}
+}
+
+func (t *topicTree[T]) Add(filter string, value T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	node := t.root
+	for _, part := range splitTopic(filter) {
+		child, ok := node.children[part]
+		if !ok {
+			child = newTopicNode[T]()
+			node.children[part] = child
+		}
+		node = child
+	}
+	node.values[value] = struct{}{}
+}
+
+func (t *topicTree[T]) Remove(filter string, value T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parts := splitTopic(filter)
+	path := make([]*topicNode[T], 0, len(parts)+1)
+	node := t.root
+	path = append(path, node)
+	for _, part := range parts {
+		child, ok := node.children[part]
+		if !ok {
+			return
+		}
+		node = child
+		path = append(path, node)
+	}
+	delete(node.values, value)
+
+	// 清理空分支
+	for i := len(parts) - 1; i >= 0; i-- {
+		child := path[i+1]
+		if len(child.values) > 0 || len(child.children) > 0 {
+			break
+		}
+		delete(path[i].children, parts[i])
+	}
+}
+
+// Match 返回订阅主题与 topic 匹配的全部订阅者，每个订阅者只出现一次
+func (t *topicTree[T]) Match(topic string) []T {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	seen := make(map[T]struct{})
+	result := make([]T, 0)
+	collect := func(node *topicNode[T]) {
+		for value := range node.values {
+			if _, ok := seen[value]; ok {
+				continue
+			}
+			seen[value] = struct{}{}
+			result = append(result, value)
+		}
+	}
+
+	var walk func(node *topicNode[T], parts []string)
+	walk = func(node *topicNode[T], parts []string) {
+		if child, ok := node.children[TopicWildcardML]; ok {
+			collect(child)
+		}
+		if len(parts) == 0 {
+			collect(node)
+			return
+		}
+		if child, ok := node.children[parts[0]]; ok {
+			walk(child, parts[1:])
+		}
+		if child, ok := node.children[TopicWildcardSL]; ok {
+			walk(child, parts[1:])
+		}
+	}
+	walk(t.root, splitTopic(topic))
+
+	return result
+}
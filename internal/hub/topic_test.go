@@ -0,0 +1,212 @@
+package hub
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"data::s1::temp", "data::s1::temp", true},
+		{"data::s1::temp", "data::s2::temp", false},
+		{"data::s1", "data::s1::temp", false},
+		{"data::s1::temp", "data::s1", false},
+
+		{"data::+::temp", "data::s1::temp", true},
+		{"data::+::temp", "data::s1::humidity", false},
+		{"data::+", "data::s1", true},
+		{"data::+", "data", false},
+		{"data::+", "data::s1::temp", false},
+		{"+::+", "data::s1", true},
+		{"+", "data", true},
+
+		{"data::#", "data::s1::temp", true},
+		{"data::#", "data::s1", true},
+		{"data::#", "data", true},
+		{"data::#", "command::s1", false},
+		{"data::+::#", "data::s1", true},
+		{"data::+::#", "data", false},
+		{"#", "data", true},
+		{"#", "data::s1::temp", true},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		valid  bool
+	}{
+		{"data", true},
+		{"data::s1::temp", true},
+		{"data::+::temp", true},
+		{"data::#", true},
+		{"data::+::#", true},
+		{"#", true},
+		{"+", true},
+
+		{"", false},
+		{"data::", false},
+		{"::data", false},
+		{"data::::temp", false},
+		{"data::s+", false},
+		{"data::+s", false},
+		{"data::#::temp", false},
+		{"#::data", false},
+		{"data#", false},
+		{"data::s#", false},
+	}
+	for _, tt := range tests {
+		err := ValidateTopicFilter(tt.filter)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateTopicFilter(%q) = %v, want valid %v", tt.filter, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		valid bool
+	}{
+		{"data::s1::temp", true},
+		{"data", true},
+		{"", false},
+		{"data::", false},
+		{"data::+", false},
+		{"data::#", false},
+	}
+	for _, tt := range tests {
+		err := ValidateTopic(tt.topic)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateTopic(%q) = %v, want valid %v", tt.topic, err, tt.valid)
+		}
+	}
+}
+
+func TestTopicTreeMatch(t *testing.T) {
+	filters := []string{
+		"data::s1::temp",
+		"data::+::temp",
+		"data::#",
+		"data::+::#",
+		"+::s1::+",
+		"#",
+		"command::s1",
+	}
+	topics := []string{
+		"data",
+		"data::s1",
+		"data::s1::temp",
+		"data::s2::humidity",
+		"command::s1",
+		"command::s1::reboot",
+	}
+
+	tree := newTopicTree[string]()
+	for _, filter := range filters {
+		tree.Add(filter, filter)
+	}
+	// 与 MatchTopic 的结果一致
+	for _, topic := range topics {
+		want := make([]string, 0)
+		for _, filter := range filters {
+			if MatchTopic(filter, topic) {
+				want = append(want, filter)
+			}
+		}
+		got := tree.Match(topic)
+		sort.Strings(want)
+		sort.Strings(got)
+		if !equalStrings(got, want) {
+			t.Errorf("Match(%q) = %v, want %v", topic, got, want)
+		}
+	}
+}
+
+func TestTopicTreeMatchDedup(t *testing.T) {
+	tree := newTopicTree[string]()
+	// 同一订阅者的多个订阅主题同时匹配时只返回一次
+	tree.Add("data::#", "c1")
+	tree.Add("data::+", "c1")
+	tree.Add("data::s1", "c1")
+	tree.Add("data::s1", "c2")
+
+	got := tree.Match("data::s1")
+	sort.Strings(got)
+	if want := []string{"c1", "c2"}; !equalStrings(got, want) {
+		t.Errorf("Match = %v, want %v", got, want)
+	}
+}
+
+func TestTopicTreeRemove(t *testing.T) {
+	tree := newTopicTree[string]()
+	tree.Add("data::s1::temp", "c1")
+	tree.Add("data::s1::temp", "c2")
+	tree.Add("data::s2", "c1")
+
+	tree.Remove("data::s1::temp", "c1")
+	if got := tree.Match("data::s1::temp"); !equalStrings(got, []string{"c2"}) {
+		t.Errorf("Match after removing c1 = %v, want [c2]", got)
+	}
+
+	// 移除最后一个订阅者后清理空分支，保留仍有订阅者的兄弟分支
+	tree.Remove("data::s1::temp", "c2")
+	data := tree.root.children["data"]
+	if data == nil {
+		t.Fatal("branch data::s2 was pruned")
+	}
+	if _, ok := data.children["s1"]; ok {
+		t.Error("empty branch data::s1 was not pruned")
+	}
+	if got := tree.Match("data::s2"); !equalStrings(got, []string{"c1"}) {
+		t.Errorf("Match(data::s2) = %v, want [c1]", got)
+	}
+
+	tree.Remove("data::s2", "c1")
+	if len(tree.root.children) != 0 {
+		t.Errorf("root still has children %v", tree.root.children)
+	}
+
+	// 移除不存在的订阅不影响其他订阅
+	tree.Add("data::s3", "c1")
+	tree.Remove("data::s3", "c2")
+	tree.Remove("data::s4", "c1")
+	if got := tree.Match("data::s3"); !equalStrings(got, []string{"c1"}) {
+		t.Errorf("Match(data::s3) = %v, want [c1]", got)
+	}
+}
+
+func TestTopicTreeRemoveKeepsParentValues(t *testing.T) {
+	tree := newTopicTree[string]()
+	tree.Add("data", "c1")
+	tree.Add("data::s1", "c2")
+
+	tree.Remove("data::s1", "c2")
+	if got := tree.Match("data"); !equalStrings(got, []string{"c1"}) {
+		t.Errorf("Match(data) = %v, want [c1]", got)
+	}
+	if len(tree.root.children["data"].children) != 0 {
+		t.Error("empty branch data::s1 was not pruned")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
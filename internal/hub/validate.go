@@ -0,0 +1,43 @@
+package hub
+
+import "errors"
+
+// 校验失败的消息以 deadletter::<原主题> 发布，Payload 中包含原消息与失败原因
+const DeadLetterTopicPrefix = "deadletter"
+
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// Validator 在消息进入 hub 时校验消息
+type Validator interface {
+	Validate(msg *Message) error
+}
+
+func (h *Hub) SetValidator(validator Validator) {
+	h.validatorMu.Lock()
+	defer h.validatorMu.Unlock()
+	h.validator = validator
+}
+
+func (h *Hub) validate(msg *Message) error {
+	h.validatorMu.RLock()
+	validator := h.validator
+	h.validatorMu.RUnlock()
+	if validator == nil {
+		return nil
+	}
+	return validator.Validate(msg)
+}
+
+// deadLetter 发布死信消息，死信消息不再校验
+func (h *Hub) deadLetter(msg *Message, reason error) {
+	deadLetter := &Message{
+		Topic:  DeadLetterTopicPrefix + TopicSeparator + msg.Topic,
+		Source: msg.Source,
+		Payload: map[string]interface{}{
+			"reason":  reason.Error(),
+			"message": msg,
+		},
+	}
+	deadLetter.stamp()
+	h.dispatch(deadLetter)
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -23,20 +24,75 @@ type Client struct {
 
 type CollectionInfo struct {
 	ClientID           string             `gorm:"primarykey" json:"clientId"`
-	DataType           CollectionDataType `json:"dataType"`           // 采集数据类型
-	CollectionPeriod   int                `json:"collectionPeriod"`   // 采集周期，单位为秒
-	LastCollectionTime time.Time          `json:"lastCollectionTime"` // 上次采集时间
-	IPAddress          string             `json:"ipAddress"`          // 客户端 IP 地址
-	CollectionEndpoint string             `json:"collectionEndpoint"` // 采集地址（URL）
-	AuthToken          string             `json:"authToken"`          // 鉴权信息，例如 token
-	CustomLabels       string             `json:"customLabels"`       // 自定义标签
+	DataType           CollectionDataType `json:"dataType"`                           // 采集数据类型
+	CollectionPeriod   int                `json:"collectionPeriod"`                   // 采集周期，单位为秒
+	LastCollectionTime time.Time          `json:"lastCollectionTime"`                 // 上次采集时间
+	IPAddress          string             `json:"ipAddress"`                          // 客户端 IP 地址
+	CollectionEndpoint string             `json:"collectionEndpoint"`                 // 采集地址（URL），Modbus 为 host:port
+	AuthToken          string             `json:"authToken"`                          // 鉴权信息，例如 token
+	CustomLabels       string             `json:"customLabels"`                       // 自定义标签
+	UnitID             uint8              `json:"unitId"`                             // Modbus 从站地址
+	Registers          []ModbusRegister   `json:"registers" gorm:"serializer:json"`   // Modbus 寄存器表
+	MetricAllow        []string           `json:"metricAllow" gorm:"serializer:json"` // 只采集匹配的指标，支持 * 通配，为空时采集全部
+	MetricDeny         []string           `json:"metricDeny" gorm:"serializer:json"`  // 不采集匹配的指标
+	Fields             []CollectionField  `json:"fields" gorm:"serializer:json"`      // JSON 响应的指标映射，为空时响应需为 {"Data": {...}, "Labels": {...}}
+	LabelFields        []CollectionLabel  `json:"labelFields" gorm:"serializer:json"` // JSON 响应的标签映射
 }
 
+// CollectionField 从 JSON 响应中提取一个指标
+//
+// 取值依次经过转换：枚举映射（或布尔值、数值字符串转换为数值）、乘以 Scale、加上 Offset。
+type CollectionField struct {
+	Path   string             `json:"path"`   // JSONPath（$.sensors[0].value）或以 . 分隔的路径（sensors.0.value）
+	Metric string             `json:"metric"` // 指标名，为空时使用路径的最后一级
+	Scale  float64            `json:"scale"`  // 换算倍数，为 0 时不换算
+	Offset float64            `json:"offset"` // 换算后加上的偏移量
+	Enum   map[string]float64 `json:"enum"`   // 取值到数值的映射，例如 {"running": 1, "stopped": 0}
+}
+
+// CollectionLabel 从 JSON 响应中提取一个标签
+type CollectionLabel struct {
+	Path  string `json:"path"`
+	Label string `json:"label"` // 标签名，为空时使用路径的最后一级
+}
+
+// ModbusRegister 一个需要读取的 Modbus 寄存器
+type ModbusRegister struct {
+	Address      uint16         `json:"address"`      // 起始地址
+	FunctionCode uint8          `json:"functionCode"` // 功能码：1 线圈、2 离散输入、3 保持寄存器、4 输入寄存器，默认为 3
+	DataType     ModbusDataType `json:"dataType"`     // 数据类型，默认为 uint16
+	ByteOrder    ModbusOrder    `json:"byteOrder"`    // 寄存器内的字节顺序，默认为 big
+	WordOrder    ModbusOrder    `json:"wordOrder"`    // 多个寄存器的顺序，默认为 big（高位在前）
+	Scale        float64        `json:"scale"`        // 换算倍数，为 0 时不换算
+	Metric       string         `json:"metric"`       // 指标名
+}
+
+type ModbusDataType string
+
+const (
+	ModbusDataTypeInt16   ModbusDataType = "int16"
+	ModbusDataTypeUint16  ModbusDataType = "uint16"
+	ModbusDataTypeInt32   ModbusDataType = "int32"
+	ModbusDataTypeUint32  ModbusDataType = "uint32"
+	ModbusDataTypeFloat32 ModbusDataType = "float32"
+	ModbusDataTypeInt64   ModbusDataType = "int64"
+	ModbusDataTypeUint64  ModbusDataType = "uint64"
+	ModbusDataTypeFloat64 ModbusDataType = "float64"
+)
+
+type ModbusOrder string
+
+const (
+	ModbusOrderBig    ModbusOrder = "big"
+	ModbusOrderLittle ModbusOrder = "little"
+)
+
 type CollectionDataType string
 
 const (
 	CollectionDataTypeJSON    CollectionDataType = "json"
 	CollectionDataTypeMetrics CollectionDataType = "metrics"
+	CollectionDataTypeModbus  CollectionDataType = "modbus"
 )
 
 type ClientStatus string
@@ -62,7 +118,7 @@ const (
 
 type Permission struct {
 	Model
-	ClientID uint   `gorm:"index" json:"clientId"`
+	ClientID string `gorm:"index" json:"clientId"`
 	Topic    string `json:"topic"`
 	Type     PermissionType
 }
@@ -90,6 +146,13 @@ func (p Permission) String() string {
 	return p.Topic + "-" + p.Type.String()
 }
 
+func (p *Permission) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return nil
+}
+
 func PrasePermission(s string) (Permission, error) {
 	if strings.Count(s, "-") != 1 {
 		return Permission{}, errors.New("invalid permission string")
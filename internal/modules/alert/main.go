@@ -12,12 +12,16 @@ import (
 
 // only handle real-time alert rules
 func handleAlertRT(h *hub.Hub, msg *hub.Message) {
+	senderID := msg.Source
+	if senderID == "" {
+		return
+	}
+
 	rules := GetRules()
 	for _, rule := range rules {
 		if rule.Type != AlertRuleTypeRealtime {
 			continue
 		}
-		senderID := msg.Payload["senderID"].(string)
 
 		for _, condition := range rule.Conditions {
 			if condition.SensorID != senderID {
@@ -45,14 +49,13 @@ func handleAlertRT(h *hub.Hub, msg *hub.Message) {
 					}),
 				})
 
-				go processAlertActions(rule, msg.Payload)
+				go processAlertActions(rule, senderID)
 			}
 		}
 	}
 }
 
-func processAlertActions(rule *AlertRule, payload map[string]interface{}) {
-	senderID := payload["senderID"].(string)
+func processAlertActions(rule *AlertRule, senderID string) {
 	for _, action := range rule.Actions {
 		switch action.Type {
 		case AlertActionTypeEmail:
@@ -76,27 +79,17 @@ func processAlertActions(rule *AlertRule, payload map[string]interface{}) {
 
 func isMatched(condition *AlertRuleCondition, payload map[string]interface{}) bool {
 	if condition.Type == AlertRuleConditionTypeOperator {
-		sensorData := global.ParseSensorDataPayload(payload).Data
-		// for operator type, check if the metric value satisfies the condition
-		if _, ok := sensorData[condition.Metric]; !ok {
-			return false
-		}
 		operator := AlertRuleConditionPayloadOperator{}
 		mapstructure.Decode(condition.Payload, &operator)
-		value := sensorData[condition.Metric]
-		switch operator.Operator {
-		case AlertRuleConditionOperatorEqual:
-			return value == operator.Value
-		case AlertRuleConditionOperatorNotEqual:
-			return value != operator.Value
-		case AlertRuleConditionOperatorGreaterThan:
-			return value > operator.Value
-		case AlertRuleConditionOperatorLessThan:
-			return value < operator.Value
-
-		default:
-			return false
+		// for operator type, check if the metric value satisfies the condition
+		// 一条消息可能包含多组序列，任一序列满足条件即匹配
+		for _, series := range global.ParseSensorDataPayload(payload).AllSeries() {
+			value, ok := series.Data[condition.Metric]
+			if ok && matchOperator(operator, value) {
+				return true
+			}
 		}
+		return false
 	}
 
 	if condition.Type == AlertRuleConditionTypeEvent {
@@ -108,8 +101,26 @@ func isMatched(condition *AlertRuleCondition, payload map[string]interface{}) bo
 	return false
 }
 
+func matchOperator(operator AlertRuleConditionPayloadOperator, value float64) bool {
+	switch operator.Operator {
+	case AlertRuleConditionOperatorEqual:
+		return value == operator.Value
+	case AlertRuleConditionOperatorNotEqual:
+		return value != operator.Value
+	case AlertRuleConditionOperatorGreaterThan:
+		return value > operator.Value
+	case AlertRuleConditionOperatorLessThan:
+		return value < operator.Value
+
+	default:
+		return false
+	}
+}
+
 func Setup() {
 	hub.AddTopicListener("data::#", handleAlertRT)
+	// 采集状态变化以事件条件匹配，例如 eventName 为 collect_suspended
+	hub.AddTopicListener("collect::status", handleAlertRT)
 
 	// migrate
 	models.AutoMigrate(&AlertRecord{})
@@ -1,108 +1,66 @@
 package collect
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
-	"sync"
 	"time"
+	"ultraphx-core/internal/config"
 	"ultraphx-core/internal/hub"
 	"ultraphx-core/internal/models"
 
 	"github.com/sirupsen/logrus"
 )
 
-type failureTracker struct {
-	mu          sync.Mutex
-	failures    map[string]int
-	suspendTime map[string]time.Time
-}
-
-func newFailureTracker() *failureTracker {
-	return &failureTracker{
-		failures:    make(map[string]int),
-		suspendTime: make(map[string]time.Time),
-	}
-}
-
-func (ft *failureTracker) recordFailure(endpoint string) {
-	ft.mu.Lock()
-	defer ft.mu.Unlock()
-	ft.failures[endpoint]++
-	if ft.failures[endpoint] >= 3 {
-		ft.suspendTime[endpoint] = time.Now().Add(2 * time.Minute)
-	}
-}
-
-func (ft *failureTracker) canRequest(endpoint string) bool {
-	ft.mu.Lock()
-	defer ft.mu.Unlock()
-	if suspendUntil, ok := ft.suspendTime[endpoint]; ok {
-		if time.Now().Before(suspendUntil) {
-			return false
-		}
-		delete(ft.failures, endpoint)
-		delete(ft.suspendTime, endpoint)
-	}
-	return true
-}
-
-var tracker = newFailureTracker()
-
-func runTick(h *hub.Hub) {
-	allClients := make([]models.Client, 0)
-	(&models.Client{}).Query().Where("status = ?", models.ClientStatusActive).Where("type = ?", models.ClientTypeSensorActive).Preload("Collection").Find(&allClients)
-	for _, client := range allClients {
-		go runCollect(&client, h)
-	}
-}
-
 func Setup(h *hub.Hub) {
-	ticker := time.NewTicker(1 * time.Second)
-	go func() {
-		for range ticker.C {
-			runTick(h)
-		}
-	}()
+	models.AutoMigrate(&CollectorHealth{})
+	tracker.load()
+
+	sched = newScheduler(h, config.GetCollectConfig())
+	sched.load()
 }
 
+// runCollect 采集一次数据并发布，成功后更新内存中的上次采集时间，暂停中的采集会被跳过
 func runCollect(client *models.Client, h *hub.Hub) {
 	if client.Collection == nil {
 		return
 	}
 	collection := client.Collection
 
-	if !tracker.canRequest(collection.CollectionEndpoint) {
-		logrus.Infof("Collection endpoint %s is suspended due to multiple failures", collection.CollectionEndpoint)
-		return
-	}
-
-	if (collection.LastCollectionTime.Add(time.Duration(collection.CollectionPeriod) * time.Second)).After(time.Now()) {
+	if time.Now().Before(tracker.suspendedUntil(client.ID)) {
 		return
 	}
 
+	start := time.Now()
 	data, err := pullData(collection)
+	latency := time.Since(start)
 	if err != nil {
-		tracker.recordFailure(collection.CollectionEndpoint)
 		logrus.Errorf("Failed to pull data from collection %s: %s", collection.CollectionEndpoint, err)
+		publishStatus(h, tracker.recordFailure(client.ID, err, latency))
 		return
 	}
 
 	pushData(client, data, h)
 	collection.LastCollectionTime = time.Now()
-	if err := collection.Query().Save(collection).Error; err != nil {
-		logrus.WithError(err).Error("Failed to update collection last collection time")
-	}
-
-	// logrus.Infof("Data collected from collection %s", collection.CollectionEndpoint)
+	publishStatus(h, tracker.recordSuccess(client.ID, latency))
 }
 
 type PullDataResult struct {
 	Data   map[string]float64
 	Labels map[string]string
+	// 指标类型的采集结果按标签分组
+	Series []MetricSeries `json:"-"`
+	// 原始响应
+	Raw []byte `json:"-"`
 }
 
 func pullData(collection *models.CollectionInfo) (result PullDataResult, err error) {
+	if collection.DataType == models.CollectionDataTypeModbus {
+		return pullModbus(collection)
+	}
+
 	httpClient := &http.Client{
 		Timeout: 5 * time.Second,
 	}
@@ -111,32 +69,59 @@ func pullData(collection *models.CollectionInfo) (result PullDataResult, err err
 		return PullDataResult{}, err
 	}
 	req.Header.Set("Authorization", collection.AuthToken)
+	if collection.DataType == models.CollectionDataTypeMetrics {
+		req.Header.Set("Accept", metricsAccept)
+	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return PullDataResult{}, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	bodyData, err := io.ReadAll(resp.Body)
+	if err != nil {
 		return PullDataResult{}, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		return PullDataResult{Raw: bodyData}, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	data, err := parseResponse(bodyData, collection)
+	data.Raw = bodyData
+	return data, err
+}
 
+// parseResponse 按数据类型解析 HTTP 响应
+func parseResponse(body []byte, collection *models.CollectionInfo) (PullDataResult, error) {
 	var data PullDataResult
-	bodyData, _ := io.ReadAll(resp.Body)
-	if collection.DataType == models.CollectionDataTypeJSON {
-		if err := json.Unmarshal(bodyData, &data); err != nil {
+	switch collection.DataType {
+	case models.CollectionDataTypeMetrics:
+		return parseMetricsResult(bytes.NewReader(body), collection)
+	case models.CollectionDataTypeJSON:
+		if len(collection.Fields) > 0 || len(collection.LabelFields) > 0 {
+			return mapJSON(body, collection)
+		}
+		if err := json.Unmarshal(body, &data); err != nil {
 			return PullDataResult{}, err
 		}
 	}
 	return data, nil
 }
 
+// pushData 将一次采集的结果作为一条 data 消息发布，指标类型的全部序列放在 series 中
 func pushData(client *models.Client, data PullDataResult, h *hub.Hub) {
+	payload := map[string]interface{}{
+		"data": data.Data,
+	}
+	if len(data.Labels) > 0 {
+		payload["labels"] = data.Labels
+	}
+	if data.Series != nil {
+		payload["series"] = data.Series
+	}
 	h.Broadcast(&hub.Message{
-		Topic: "data",
-		Payload: map[string]interface{}{
-			"senderID": client.ID,
-			"data":     data.Data,
-		},
+		Topic:   "data",
+		Source:  client.ID,
+		Payload: payload,
 	})
 }
@@ -0,0 +1,230 @@
+package collect
+
+import (
+	"sync"
+	"time"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// StatusTopic 采集状态变化时发布的主题
+const StatusTopic = "collect::status"
+
+type CollectorState string
+
+const (
+	CollectorStateOK = CollectorState("ok")
+	// 最近的采集失败，但尚未达到暂停的次数
+	CollectorStateDegraded = CollectorState("degraded")
+	// 连续失败次数过多，暂停采集直到 SuspendedUntil
+	CollectorStateSuspended = CollectorState("suspended")
+)
+
+// CollectorHealth 主动传感器的采集状态
+type CollectorHealth struct {
+	ClientID            string         `gorm:"primarykey" json:"clientId"`
+	State               CollectorState `json:"state"`
+	LastSuccessAt       *time.Time     `json:"lastSuccessAt"`
+	LastErrorAt         *time.Time     `json:"lastErrorAt"`
+	LastError           string         `json:"lastError"`
+	ConsecutiveFailures int            `json:"consecutiveFailures"`
+	Latency             int64          `json:"latency"` // 最近一次采集的耗时，单位为毫秒
+	SuspendedUntil      *time.Time     `json:"suspendedUntil"`
+	UpdatedAt           time.Time      `json:"updatedAt"`
+}
+
+func (c *CollectorHealth) Query() *gorm.DB {
+	return models.DB.Model(c)
+}
+
+// statusChange 一次状态变化
+type statusChange struct {
+	health   CollectorHealth
+	previous CollectorState
+}
+
+type healthTracker struct {
+	mu        sync.Mutex
+	health    map[string]*CollectorHealth
+	persisted map[string]time.Time
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{
+		health:    make(map[string]*CollectorHealth),
+		persisted: make(map[string]time.Time),
+	}
+}
+
+var tracker = newHealthTracker()
+
+// load 从数据库读取保存的采集状态
+func (t *healthTracker) load() {
+	var records []CollectorHealth
+	if err := (&CollectorHealth{}).Query().Find(&records).Error; err != nil {
+		logrus.WithError(err).Error("Failed to load collector health")
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range records {
+		t.health[records[i].ClientID] = &records[i]
+		t.persisted[records[i].ClientID] = records[i].UpdatedAt
+	}
+}
+
+func (t *healthTracker) entry(clientID string) *CollectorHealth {
+	health, ok := t.health[clientID]
+	if !ok {
+		health = &CollectorHealth{ClientID: clientID}
+		t.health[clientID] = health
+	}
+	return health
+}
+
+// suspendedUntil 返回暂停采集的截止时间，未暂停时返回零值
+func (t *healthTracker) suspendedUntil(clientID string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	health, ok := t.health[clientID]
+	if !ok || health.State != CollectorStateSuspended || health.SuspendedUntil == nil {
+		return time.Time{}
+	}
+	return *health.SuspendedUntil
+}
+
+// suspendDuration 按连续失败次数计算暂停时长，达到暂停次数后每多失败一次翻倍
+func suspendDuration(failures int, cfg *config.CollectConfig) time.Duration {
+	d := cfg.MinBackoff
+	for i := cfg.SuspendAfter; i < failures && d < cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, cfg.MaxBackoff)
+}
+
+func (t *healthTracker) recordSuccess(clientID string, latency time.Duration) *statusChange {
+	now := time.Now()
+	return t.update(clientID, func(health *CollectorHealth) {
+		health.State = CollectorStateOK
+		health.LastSuccessAt = &now
+		health.ConsecutiveFailures = 0
+		health.Latency = latency.Milliseconds()
+		health.SuspendedUntil = nil
+	})
+}
+
+func (t *healthTracker) recordFailure(clientID string, err error, latency time.Duration) *statusChange {
+	cfg := config.GetCollectConfig()
+	now := time.Now()
+	return t.update(clientID, func(health *CollectorHealth) {
+		health.LastErrorAt = &now
+		health.LastError = err.Error()
+		health.ConsecutiveFailures++
+		health.Latency = latency.Milliseconds()
+		if health.ConsecutiveFailures < cfg.SuspendAfter {
+			health.State = CollectorStateDegraded
+			return
+		}
+		until := now.Add(suspendDuration(health.ConsecutiveFailures, cfg))
+		health.State = CollectorStateSuspended
+		health.SuspendedUntil = &until
+	})
+}
+
+// update 修改采集状态，状态变化、失败或距上次写回超过 PersistInterval 时写回数据库，
+// 状态变化时返回变化内容
+func (t *healthTracker) update(clientID string, fn func(health *CollectorHealth)) *statusChange {
+	t.mu.Lock()
+	health := t.entry(clientID)
+	previous := health.State
+	fn(health)
+	health.UpdatedAt = time.Now()
+	snapshot := *health
+
+	changed := previous != health.State
+	persist := changed || health.ConsecutiveFailures > 0 ||
+		health.UpdatedAt.Sub(t.persisted[clientID]) >= config.GetCollectConfig().PersistInterval
+	if persist {
+		t.persisted[clientID] = health.UpdatedAt
+	}
+	t.mu.Unlock()
+
+	if persist {
+		if err := snapshot.Query().Save(&snapshot).Error; err != nil {
+			logrus.WithError(err).Error("Failed to save collector health")
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return &statusChange{
+		health:   snapshot,
+		previous: previous,
+	}
+}
+
+// remove 删除客户端的采集状态
+func (t *healthTracker) remove(clientID string) {
+	t.mu.Lock()
+	delete(t.health, clientID)
+	delete(t.persisted, clientID)
+	t.mu.Unlock()
+
+	if err := (&CollectorHealth{}).Query().Where("client_id = ?", clientID).Delete(&CollectorHealth{}).Error; err != nil {
+		logrus.WithError(err).Error("Failed to delete collector health")
+	}
+}
+
+// publishStatus 发布采集状态变化，eventName 为 collect_<状态>，可以在告警规则中作为事件条件使用
+func publishStatus(h *hub.Hub, change *statusChange) {
+	if change == nil {
+		return
+	}
+	health := change.health
+	entry := logrus.WithField("client", health.ClientID).WithField("state", health.State)
+	if health.State == CollectorStateOK {
+		entry.Info("Collector recovered")
+	} else {
+		entry.WithField("failures", health.ConsecutiveFailures).Warn("Collector state changed: ", health.LastError)
+	}
+
+	h.Broadcast(&hub.Message{
+		Topic:  StatusTopic,
+		Source: health.ClientID,
+		Payload: map[string]interface{}{
+			"eventName":           "collect_" + string(health.State),
+			"clientId":            health.ClientID,
+			"state":               health.State,
+			"previousState":       change.previous,
+			"consecutiveFailures": health.ConsecutiveFailures,
+			"lastError":           health.LastError,
+			"suspendedUntil":      health.SuspendedUntil,
+		},
+	})
+}
+
+// Statuses 返回全部主动传感器的采集状态
+func Statuses() []CollectorHealth {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	statuses := make([]CollectorHealth, 0, len(tracker.health))
+	for _, health := range tracker.health {
+		statuses = append(statuses, *health)
+	}
+	return statuses
+}
+
+// Status 返回客户端的采集状态，尚未采集过时返回 false
+func Status(clientID string) (CollectorHealth, bool) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	health, ok := tracker.health[clientID]
+	if !ok {
+		return CollectorHealth{}, false
+	}
+	return *health, true
+}
@@ -0,0 +1,92 @@
+package collect
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"ultraphx-core/internal/models"
+)
+
+// 原始响应最多返回的字节数
+const rawExcerptSize = 4096
+
+var (
+	errCollectorNotReady = errors.New("collect module is not ready")
+	errNoCollection      = errors.New("client has no collection info")
+)
+
+// ManualResult 一次手动采集的结果
+type ManualResult struct {
+	Raw       string             `json:"raw"`       // 原始响应的开头部分
+	Truncated bool               `json:"truncated"` // 原始响应是否被截断
+	Data      map[string]float64 `json:"data"`
+	Labels    map[string]string  `json:"labels"`
+	Series    []MetricSeries     `json:"series,omitempty"` // 指标类型按标签分组的结果
+	Latency   int64              `json:"latency"`          // 单位为毫秒
+	Error     string             `json:"error,omitempty"`
+	Published bool               `json:"published"`
+}
+
+// collectOnce 采集一次并整理结果
+func collectOnce(collection *models.CollectionInfo) (ManualResult, PullDataResult, error) {
+	start := time.Now()
+	data, err := pullData(collection)
+	result := ManualResult{
+		Data:    data.Data,
+		Labels:  data.Labels,
+		Series:  data.Series,
+		Latency: time.Since(start).Milliseconds(),
+	}
+	raw := data.Raw
+	if len(raw) > rawExcerptSize {
+		raw = raw[:rawExcerptSize]
+		result.Truncated = true
+	}
+	result.Raw = strings.ToValidUTF8(string(raw), "")
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, data, err
+}
+
+// Validate 检查采集配置是否可以使用，目前只检查 Modbus 的寄存器表
+func Validate(collection *models.CollectionInfo) error {
+	if collection.DataType == models.CollectionDataTypeModbus {
+		return validateRegisters(collection.Registers)
+	}
+	return nil
+}
+
+// Test 使用尚未保存的采集配置采集一次，不发布数据，也不影响采集状态
+func Test(collection *models.CollectionInfo) ManualResult {
+	result, _, _ := collectOnce(collection)
+	return result
+}
+
+// CollectNow 立即采集一次客户端的数据，publish 为 true 时像定时采集一样发布数据并更新采集状态
+func CollectNow(clientID string, publish bool) (ManualResult, error) {
+	if sched == nil {
+		return ManualResult{}, errCollectorNotReady
+	}
+	client := models.Client{}
+	if err := client.Query().Where("id = ?", clientID).Preload("Collection").First(&client).Error; err != nil {
+		return ManualResult{}, err
+	}
+	if client.Collection == nil {
+		return ManualResult{}, errNoCollection
+	}
+
+	result, data, err := collectOnce(client.Collection)
+	if !publish {
+		return result, nil
+	}
+	latency := time.Duration(result.Latency) * time.Millisecond
+	if err != nil {
+		publishStatus(sched.h, tracker.recordFailure(client.ID, err, latency))
+		return result, nil
+	}
+	pushData(&client, data, sched.h)
+	publishStatus(sched.h, tracker.recordSuccess(client.ID, latency))
+	result.Published = true
+	return result, nil
+}
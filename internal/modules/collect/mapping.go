@@ -0,0 +1,91 @@
+package collect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/pkg/global"
+)
+
+var errNoMappedValue = errors.New("no mapped field found in response")
+
+// mapJSON 按采集配置中的字段映射从任意 JSON 响应中提取指标与标签
+func mapJSON(body []byte, collection *models.CollectionInfo) (PullDataResult, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return PullDataResult{}, err
+	}
+
+	result := PullDataResult{
+		Data:   make(map[string]float64),
+		Labels: make(map[string]string),
+	}
+	for _, field := range collection.Fields {
+		v, ok := global.LookupPath(value, field.Path)
+		if !ok {
+			continue
+		}
+		f, ok := fieldValue(field, v)
+		if !ok {
+			continue
+		}
+		metric := field.Metric
+		if metric == "" {
+			metric = global.PathName(field.Path)
+		}
+		result.Data[metric] = f
+	}
+	for _, label := range collection.LabelFields {
+		v, ok := global.LookupPath(value, label.Path)
+		if !ok {
+			continue
+		}
+		name := label.Label
+		if name == "" {
+			name = global.PathName(label.Path)
+		}
+		result.Labels[name] = labelValue(v)
+	}
+
+	if len(collection.Fields) > 0 && len(result.Data) == 0 {
+		return PullDataResult{}, errNoMappedValue
+	}
+	return result, nil
+}
+
+// fieldValue 按字段配置转换取值
+func fieldValue(field models.CollectionField, v interface{}) (float64, bool) {
+	var f float64
+	mapped := false
+	if len(field.Enum) > 0 {
+		f, mapped = field.Enum[labelValue(v)]
+	}
+	if !mapped {
+		var ok bool
+		if f, ok = global.ToFloat(v); !ok {
+			return 0, false
+		}
+	}
+	if field.Scale != 0 {
+		f *= field.Scale
+	}
+	return f + field.Offset, true
+}
+
+// labelValue 将 JSON 值转换为字符串
+func labelValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
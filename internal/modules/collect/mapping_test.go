@@ -0,0 +1,153 @@
+package collect
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"ultraphx-core/internal/models"
+)
+
+const mappingBody = `{
+	"sensors": [
+		{"name": "t1", "value": 21.5},
+		{"name": "t2", "value": "22.5"}
+	],
+	"state": "running",
+	"power": "ON",
+	"online": true,
+	"fault": false,
+	"voltage": 2305,
+	"temp_f": 70,
+	"device": {"id": 7, "model": "X"},
+	"nothing": null
+}`
+
+func TestMapJSONFields(t *testing.T) {
+	collection := &models.CollectionInfo{
+		Fields: []models.CollectionField{
+			{Path: "sensors.0.value", Metric: "t1"},
+			// 数值字符串，指标名默认为路径的最后一级
+			{Path: "$.sensors[-1].value"},
+			// 枚举
+			{Path: "state", Enum: map[string]float64{"running": 1, "stopped": 0}},
+			{Path: "device.id", Metric: "mode", Enum: map[string]float64{"7": 3}},
+			// 枚举没有对应的取值且无法转换为数值时跳过
+			{Path: "state", Metric: "state_unmapped", Enum: map[string]float64{"stopped": 0}},
+			// 枚举没有对应的取值时按数值转换
+			{Path: "voltage", Metric: "voltage_raw", Enum: map[string]float64{"0": -1}},
+			// 布尔值与 ON/OFF
+			{Path: "power"},
+			{Path: "online"},
+			{Path: "fault"},
+			{Path: "fault", Metric: "fault_enum", Enum: map[string]float64{"false": 5}},
+			// 换算
+			{Path: "voltage", Scale: 0.1},
+			{Path: "temp_f", Metric: "temp_offset", Offset: -32},
+			{Path: "temp_f", Metric: "temp_scaled", Scale: 0.5, Offset: -10},
+			{Path: "state", Metric: "state_scaled", Enum: map[string]float64{"running": 2}, Scale: 10, Offset: 1},
+			// 缺失的字段与无法转换的值
+			{Path: "missing"},
+			{Path: "sensors.5.value", Metric: "t6"},
+			{Path: "device.model", Metric: "model"},
+			{Path: "nothing"},
+		},
+	}
+	result, err := mapJSON([]byte(mappingBody), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"t1":           21.5,
+		"value":        22.5,
+		"state":        1,
+		"mode":         3,
+		"voltage_raw":  2305,
+		"power":        1,
+		"online":       1,
+		"fault":        0,
+		"fault_enum":   5,
+		"voltage":      230.5,
+		"temp_offset":  38,
+		"temp_scaled":  25,
+		"state_scaled": 21,
+	}
+	if len(result.Data) != len(want) {
+		t.Errorf("Data = %v, want %v", result.Data, want)
+	}
+	for metric, value := range want {
+		if got, ok := result.Data[metric]; !ok || math.Abs(got-value) > 1e-9 {
+			t.Errorf("%s = %v (found %v), want %v", metric, got, ok, value)
+		}
+	}
+}
+
+func TestMapJSONLabels(t *testing.T) {
+	collection := &models.CollectionInfo{
+		LabelFields: []models.CollectionLabel{
+			{Path: "device.model"},
+			{Path: "device.id", Label: "device_id"},
+			{Path: "$.sensors[0].name", Label: "first"},
+			{Path: "online", Label: "online"},
+			{Path: "device", Label: "device"},
+			{Path: "nothing", Label: "nothing"},
+			{Path: "missing", Label: "missing"},
+		},
+	}
+	result, err := mapJSON([]byte(mappingBody), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"model":     "X",
+		"device_id": "7",
+		"first":     "t1",
+		"online":    "true",
+		"device":    `{"id":7,"model":"X"}`,
+		"nothing":   "",
+	}
+	if !reflect.DeepEqual(result.Labels, want) {
+		t.Errorf("Labels = %v, want %v", result.Labels, want)
+	}
+	// 只配置标签时不要求有指标
+	if len(result.Data) != 0 {
+		t.Errorf("Data = %v, want empty", result.Data)
+	}
+}
+
+func TestMapJSONErrors(t *testing.T) {
+	collection := &models.CollectionInfo{
+		Fields: []models.CollectionField{{Path: "missing"}, {Path: "device.model"}},
+	}
+	if _, err := mapJSON([]byte(mappingBody), collection); !errors.Is(err, errNoMappedValue) {
+		t.Errorf("mapJSON without mapped values = %v, want %v", err, errNoMappedValue)
+	}
+	if _, err := mapJSON([]byte(`{"value":`), collection); err == nil {
+		t.Error("mapJSON with invalid JSON returned no error")
+	}
+}
+
+func TestParseResponseJSON(t *testing.T) {
+	// 没有字段映射时响应需为 {"Data": {...}, "Labels": {...}}
+	result, err := parseResponse([]byte(`{"Data": {"temperature": 21.5}, "Labels": {"room": "a"}}`), &models.CollectionInfo{
+		DataType: models.CollectionDataTypeJSON,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Data["temperature"] != 21.5 || result.Labels["room"] != "a" {
+		t.Errorf("parseResponse = %+v", result)
+	}
+
+	// 配置了字段映射时按映射提取
+	result, err = parseResponse([]byte(mappingBody), &models.CollectionInfo{
+		DataType: models.CollectionDataTypeJSON,
+		Fields:   []models.CollectionField{{Path: "voltage", Scale: 0.1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Data["voltage"] != 230.5 {
+		t.Errorf("parseResponse with fields = %+v", result)
+	}
+}
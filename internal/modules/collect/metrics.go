@@ -0,0 +1,255 @@
+package collect
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/pkg/global"
+)
+
+// Prometheus 文本格式与 OpenMetrics 解析
+//
+// 同时接受 text/plain;version=0.0.4 与 application/openmetrics-text，
+// 时间戳与 exemplar 会被忽略，NaN 与 ±Inf 样本无法以 JSON 发送，也会被丢弃。
+const metricsAccept = "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+
+type MetricType string
+
+const (
+	MetricTypeCounter   MetricType = "counter"
+	MetricTypeGauge     MetricType = "gauge"
+	MetricTypeHistogram MetricType = "histogram"
+	MetricTypeSummary   MetricType = "summary"
+	MetricTypeUnknown   MetricType = "unknown"
+)
+
+// MetricSample 一个样本
+type MetricSample struct {
+	Name   string            // 样本名，例如 http_request_duration_seconds_bucket
+	Family string            // 所属指标名，例如 http_request_duration_seconds
+	Type   MetricType        // 所属指标的类型
+	Labels map[string]string // 样本标签，直方图与摘要包含 le、quantile
+	Value  float64
+}
+
+// MetricSeries 标签相同的一组样本，一次采集的全部序列在同一条 data 消息中发送
+type MetricSeries = global.SensorSeries
+
+// 样本名后缀，用于找到样本所属的指标
+var metricSuffixes = []string{"_bucket", "_count", "_sum", "_total", "_created", "_gcount", "_gsum", "_info"}
+
+// metricFamily 返回样本所属的指标名与类型
+func metricFamily(name string, types map[string]MetricType) (string, MetricType) {
+	if t, ok := types[name]; ok {
+		return name, t
+	}
+	for _, suffix := range metricSuffixes {
+		if family, ok := strings.CutSuffix(name, suffix); ok {
+			if t, ok := types[family]; ok {
+				return family, t
+			}
+		}
+	}
+	return name, MetricTypeUnknown
+}
+
+// parseMetrics 解析文本格式的指标
+func parseMetrics(r io.Reader) ([]MetricSample, error) {
+	types := make(map[string]MetricType)
+	samples := make([]MetricSample, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[1] == "EOF" {
+				break
+			}
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = MetricType(fields[3])
+			}
+			continue
+		}
+
+		sample, err := parseSampleLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		// _created 是指标的创建时间，不是测量值
+		if strings.HasSuffix(sample.Name, "_created") {
+			continue
+		}
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		sample.Family, sample.Type = metricFamily(sample.Name, types)
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+// parseSampleLine 解析 name{label="value",...} value [timestamp] [# exemplar]
+func parseSampleLine(line string) (MetricSample, error) {
+	sample := MetricSample{
+		Labels: make(map[string]string),
+	}
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+	sample.Name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, remaining, err := parseLabels(rest[1:])
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = remaining
+	}
+
+	if i := strings.Index(rest, "#"); i >= 0 {
+		rest = rest[:i]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return sample, fmt.Errorf("missing value for %s", sample.Name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value for %s: %w", sample.Name, err)
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseLabels 解析标签直到右花括号，返回剩余部分
+func parseLabels(s string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, "", fmt.Errorf("invalid label in %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if !strings.HasPrefix(s, `"`) {
+			return nil, "", fmt.Errorf("label %s is not quoted", name)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, "", fmt.Errorf("unterminated value for label %s", name)
+		}
+		labels[name] = value.String()
+		s = s[i+1:]
+	}
+}
+
+// matchMetric 判断样本名或指标名是否匹配任一通配模式
+func matchMetric(patterns []string, sample MetricSample) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, sample.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, sample.Family); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filterMetrics 按采集配置的允许与拒绝列表过滤样本，允许列表为空时允许全部
+func filterMetrics(samples []MetricSample, collection *models.CollectionInfo) []MetricSample {
+	filtered := make([]MetricSample, 0, len(samples))
+	for _, sample := range samples {
+		if len(collection.MetricAllow) > 0 && !matchMetric(collection.MetricAllow, sample) {
+			continue
+		}
+		if matchMetric(collection.MetricDeny, sample) {
+			continue
+		}
+		filtered = append(filtered, sample)
+	}
+	return filtered
+}
+
+func labelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(name)
+		key.WriteByte('=')
+		key.WriteString(strconv.Quote(labels[name]))
+		key.WriteByte(',')
+	}
+	return key.String()
+}
+
+// groupSeries 将标签相同的样本合并，保持样本出现的顺序
+func groupSeries(samples []MetricSample) []MetricSeries {
+	series := make([]MetricSeries, 0)
+	index := make(map[string]int)
+	for _, sample := range samples {
+		key := labelsKey(sample.Labels)
+		i, ok := index[key]
+		if !ok {
+			i = len(series)
+			index[key] = i
+			series = append(series, MetricSeries{
+				Labels: sample.Labels,
+				Data:   make(map[string]float64),
+			})
+		}
+		series[i].Data[sample.Name] = sample.Value
+	}
+	return series
+}
+
+// parseMetricsResult 将指标文本转换为采集结果
+func parseMetricsResult(body io.Reader, collection *models.CollectionInfo) (PullDataResult, error) {
+	samples, err := parseMetrics(body)
+	if err != nil {
+		return PullDataResult{}, err
+	}
+	return PullDataResult{
+		Series: groupSeries(filterMetrics(samples, collection)),
+	}, nil
+}
@@ -0,0 +1,176 @@
+package collect
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"ultraphx-core/internal/models"
+)
+
+func TestParseSampleLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{`up 1`, "up", map[string]string{}, 1},
+		{`up{} 1`, "up", map[string]string{}, 1},
+		{`temperature{room="a",floor="1"} 21.5`, "temperature", map[string]string{"room": "a", "floor": "1"}, 21.5},
+		{`temperature{ room = "a" , } 21.5`, "temperature", map[string]string{"room": "a"}, 21.5},
+		{"temperature\t21.5", "temperature", map[string]string{}, 21.5},
+		{`big 1.5e+09`, "big", map[string]string{}, 1.5e9},
+		{`negative -3`, "negative", map[string]string{}, -3},
+
+		// 转义的标签值
+		{`a{path="C:\\dir"} 1`, "a", map[string]string{"path": `C:\dir`}, 1},
+		{`a{msg="say \"hi\""} 1`, "a", map[string]string{"msg": `say "hi"`}, 1},
+		{`a{msg="line1\nline2"} 1`, "a", map[string]string{"msg": "line1\nline2"}, 1},
+		{`a{x="}, #{"} 1`, "a", map[string]string{"x": "}, #{"}, 1},
+
+		// 时间戳与 exemplar 被忽略
+		{`requests_total 5 1700000000000`, "requests_total", map[string]string{}, 5},
+		{`requests_total{code="200"} 5 1700000000.123`, "requests_total", map[string]string{"code": "200"}, 5},
+		{`requests_total 5 # {trace_id="abc"} 1.0 1700000000`, "requests_total", map[string]string{}, 5},
+		{`latency_bucket{le="0.5"} 3 # {trace_id="abc"} 0.3`, "latency_bucket", map[string]string{"le": "0.5"}, 3},
+	}
+	for _, tt := range tests {
+		sample, err := parseSampleLine(tt.line)
+		if err != nil {
+			t.Errorf("parseSampleLine(%q) error: %v", tt.line, err)
+			continue
+		}
+		if sample.Name != tt.name || sample.Value != tt.value || !reflect.DeepEqual(sample.Labels, tt.labels) {
+			t.Errorf("parseSampleLine(%q) = %s %v %v, want %s %v %v", tt.line, sample.Name, sample.Labels, sample.Value, tt.name, tt.labels, tt.value)
+		}
+	}
+}
+
+func TestParseSampleLineErrors(t *testing.T) {
+	lines := []string{
+		`{room="a"} 1`,
+		`up`,
+		`up{}`,
+		`up abc`,
+		`up{room=a} 1`,
+		`up{room="a} 1`,
+		`up{="a"} 1`,
+	}
+	for _, line := range lines {
+		if _, err := parseSampleLine(line); err == nil {
+			t.Errorf("parseSampleLine(%q) returned no error", line)
+		}
+	}
+}
+
+const openMetricsBody = `# HELP http_request_duration_seconds Request latency.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.1"} 2
+http_request_duration_seconds_bucket{le="1"} 5
+http_request_duration_seconds_bucket{le="+Inf"} 6
+http_request_duration_seconds_sum 3.5
+http_request_duration_seconds_count 6
+http_request_duration_seconds_created 1700000000
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.05
+rpc_duration_seconds{quantile="0.99"} NaN
+rpc_duration_seconds_sum 17
+rpc_duration_seconds_count 200
+# TYPE requests counter
+requests_total{code="200"} 1027 1700000000000
+requests_created{code="200"} 1700000000
+# TYPE temperature gauge
+temperature +Inf
+pressure -Inf
+humidity 40
+# EOF
+ignored_after_eof 1
+`
+
+func TestParseMetrics(t *testing.T) {
+	samples, err := parseMetrics(strings.NewReader(openMetricsBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		family string
+		typ    MetricType
+		labels map[string]string
+		value  float64
+	}
+	want := map[string][]result{
+		"http_request_duration_seconds_bucket": {
+			{"http_request_duration_seconds", MetricTypeHistogram, map[string]string{"le": "0.1"}, 2},
+			{"http_request_duration_seconds", MetricTypeHistogram, map[string]string{"le": "1"}, 5},
+			{"http_request_duration_seconds", MetricTypeHistogram, map[string]string{"le": "+Inf"}, 6},
+		},
+		"http_request_duration_seconds_sum":   {{"http_request_duration_seconds", MetricTypeHistogram, map[string]string{}, 3.5}},
+		"http_request_duration_seconds_count": {{"http_request_duration_seconds", MetricTypeHistogram, map[string]string{}, 6}},
+		"rpc_duration_seconds":                {{"rpc_duration_seconds", MetricTypeSummary, map[string]string{"quantile": "0.5"}, 0.05}},
+		"rpc_duration_seconds_sum":            {{"rpc_duration_seconds", MetricTypeSummary, map[string]string{}, 17}},
+		"rpc_duration_seconds_count":          {{"rpc_duration_seconds", MetricTypeSummary, map[string]string{}, 200}},
+		"requests_total":                      {{"requests", MetricTypeCounter, map[string]string{"code": "200"}, 1027}},
+		"humidity":                            {{"humidity", MetricTypeUnknown, map[string]string{}, 40}},
+	}
+
+	got := make(map[string][]result)
+	for _, sample := range samples {
+		got[sample.Name] = append(got[sample.Name], result{sample.Family, sample.Type, sample.Labels, sample.Value})
+	}
+	// _created、NaN、±Inf 与 # EOF 之后的样本被丢弃
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMetrics =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestParseMetricsPrometheusText(t *testing.T) {
+	body := `# HELP node_load1 1m load average.
+# TYPE node_load1 gauge
+node_load1 0.42
+# TYPE node_cpu_seconds_total counter
+node_cpu_seconds_total{cpu="0",mode="idle"} 100.5
+node_cpu_seconds_total{cpu="0",mode="user"} 20
+`
+	samples, err := parseMetrics(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("parseMetrics returned %d samples, want 3", len(samples))
+	}
+	// 0.0.4 格式中 counter 的 TYPE 行使用完整的样本名
+	if s := samples[1]; s.Family != "node_cpu_seconds_total" || s.Type != MetricTypeCounter {
+		t.Errorf("counter sample = %+v", s)
+	}
+}
+
+func TestParseMetricsReportsLine(t *testing.T) {
+	_, err := parseMetrics(strings.NewReader("# TYPE up gauge\nup 1\nup{job=x} 1\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("parseMetrics error = %v, want error on line 3", err)
+	}
+}
+
+func TestParseMetricsResult(t *testing.T) {
+	collection := &models.CollectionInfo{
+		MetricAllow: []string{"http_request_duration_seconds", "requests*", "humidity"},
+		MetricDeny:  []string{"*_bucket"},
+	}
+	result, err := parseMetricsResult(strings.NewReader(openMetricsBody), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 标签相同的样本合并为一组，保持出现的顺序
+	want := []MetricSeries{
+		{Labels: map[string]string{}, Data: map[string]float64{
+			"http_request_duration_seconds_sum":   3.5,
+			"http_request_duration_seconds_count": 6,
+			"humidity":                            40,
+		}},
+		{Labels: map[string]string{"code": "200"}, Data: map[string]float64{"requests_total": 1027}},
+	}
+	if !reflect.DeepEqual(result.Series, want) {
+		t.Errorf("Series = %+v, want %+v", result.Series, want)
+	}
+}
@@ -0,0 +1,190 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+	"ultraphx-core/internal/models"
+
+	"github.com/goburrow/modbus"
+)
+
+const (
+	defaultModbusPort = "502"
+	modbusTimeout     = 5 * time.Second
+)
+
+var (
+	errNoRegisters    = errors.New("modbus collection requires at least one register")
+	errNoModbusMetric = errors.New("modbus register metric is required")
+)
+
+// modbusAddress 将采集地址转换为 host:port，未指定端口时使用 502
+func modbusAddress(endpoint string) string {
+	endpoint = strings.TrimPrefix(endpoint, "tcp://")
+	endpoint = strings.TrimPrefix(endpoint, "modbus://")
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		return net.JoinHostPort(endpoint, defaultModbusPort)
+	}
+	return endpoint
+}
+
+// registerCount 返回数据类型占用的寄存器数量
+func registerCount(dataType models.ModbusDataType) (uint16, error) {
+	switch dataType {
+	case models.ModbusDataTypeInt16, models.ModbusDataTypeUint16, "":
+		return 1, nil
+	case models.ModbusDataTypeInt32, models.ModbusDataTypeUint32, models.ModbusDataTypeFloat32:
+		return 2, nil
+	case models.ModbusDataTypeInt64, models.ModbusDataTypeUint64, models.ModbusDataTypeFloat64:
+		return 4, nil
+	}
+	return 0, fmt.Errorf("unsupported modbus data type %s", dataType)
+}
+
+// decodeRegisters 按字节序与字序将寄存器内容转换为数值
+func decodeRegisters(raw []byte, reg models.ModbusRegister) (float64, error) {
+	count, err := registerCount(reg.DataType)
+	if err != nil {
+		return 0, err
+	}
+	if len(raw) < int(count)*2 {
+		return 0, fmt.Errorf("short modbus response: %d bytes", len(raw))
+	}
+
+	words := make([][]byte, count)
+	for i := range words {
+		word := []byte{raw[i*2], raw[i*2+1]}
+		if reg.ByteOrder == models.ModbusOrderLittle {
+			word[0], word[1] = word[1], word[0]
+		}
+		words[i] = word
+	}
+	if reg.WordOrder == models.ModbusOrderLittle {
+		for i, j := 0, len(words)-1; i < j; i, j = i+1, j-1 {
+			words[i], words[j] = words[j], words[i]
+		}
+	}
+	data := make([]byte, 0, count*2)
+	for _, word := range words {
+		data = append(data, word...)
+	}
+
+	switch reg.DataType {
+	case models.ModbusDataTypeInt16:
+		return float64(int16(binary.BigEndian.Uint16(data))), nil
+	case models.ModbusDataTypeInt32:
+		return float64(int32(binary.BigEndian.Uint32(data))), nil
+	case models.ModbusDataTypeUint32:
+		return float64(binary.BigEndian.Uint32(data)), nil
+	case models.ModbusDataTypeFloat32:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	case models.ModbusDataTypeInt64:
+		return float64(int64(binary.BigEndian.Uint64(data))), nil
+	case models.ModbusDataTypeUint64:
+		return float64(binary.BigEndian.Uint64(data)), nil
+	case models.ModbusDataTypeFloat64:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	}
+	return float64(binary.BigEndian.Uint16(data)), nil
+}
+
+// validateRegisters 检查寄存器表，每个寄存器都需要指标名、受支持的功能码与数据类型
+func validateRegisters(registers []models.ModbusRegister) error {
+	if len(registers) == 0 {
+		return errNoRegisters
+	}
+	for _, reg := range registers {
+		if strings.TrimSpace(reg.Metric) == "" {
+			return fmt.Errorf("register at %d: %w", reg.Address, errNoModbusMetric)
+		}
+		if reg.FunctionCode > 4 {
+			return fmt.Errorf("register %s: unsupported modbus function code %d", reg.Metric, reg.FunctionCode)
+		}
+		if _, err := registerCount(reg.DataType); err != nil {
+			return fmt.Errorf("register %s: %w", reg.Metric, err)
+		}
+	}
+	return nil
+}
+
+// readRegister 读取一个寄存器并换算，同时返回读到的原始字节
+func readRegister(client modbus.Client, reg models.ModbusRegister) (float64, []byte, error) {
+	var (
+		raw []byte
+		err error
+	)
+	switch reg.FunctionCode {
+	case 1, 2:
+		if reg.FunctionCode == 1 {
+			raw, err = client.ReadCoils(reg.Address, 1)
+		} else {
+			raw, err = client.ReadDiscreteInputs(reg.Address, 1)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(raw) == 0 {
+			return 0, nil, fmt.Errorf("empty modbus response")
+		}
+		return float64(raw[0] & 1), raw, nil
+	case 3, 4, 0:
+		var count uint16
+		if count, err = registerCount(reg.DataType); err != nil {
+			return 0, nil, err
+		}
+		if reg.FunctionCode == 4 {
+			raw, err = client.ReadInputRegisters(reg.Address, count)
+		} else {
+			raw, err = client.ReadHoldingRegisters(reg.Address, count)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, fmt.Errorf("unsupported modbus function code %d", reg.FunctionCode)
+	}
+
+	value, err := decodeRegisters(raw, reg)
+	if err != nil {
+		return 0, raw, err
+	}
+	if reg.Scale != 0 {
+		value *= reg.Scale
+	}
+	return value, raw, nil
+}
+
+// pullModbus 通过 Modbus TCP 读取寄存器表中的全部寄存器，原始响应为每个寄存器读到的字节
+func pullModbus(collection *models.CollectionInfo) (PullDataResult, error) {
+	handler := modbus.NewTCPClientHandler(modbusAddress(collection.CollectionEndpoint))
+	handler.SlaveId = collection.UnitID
+	handler.Timeout = modbusTimeout
+	if err := handler.Connect(); err != nil {
+		return PullDataResult{}, err
+	}
+	defer handler.Close()
+
+	client := modbus.NewClient(handler)
+	result := PullDataResult{
+		Data: make(map[string]float64),
+	}
+	var raw bytes.Buffer
+	for _, reg := range collection.Registers {
+		value, data, err := readRegister(client, reg)
+		if data != nil {
+			fmt.Fprintf(&raw, "%s fc%d@%d: % x\n", reg.Metric, reg.FunctionCode, reg.Address, data)
+		}
+		if err != nil {
+			return PullDataResult{Raw: raw.Bytes()}, fmt.Errorf("register %s at %d: %w", reg.Metric, reg.Address, err)
+		}
+		result.Data[reg.Metric] = value
+	}
+	result.Raw = raw.Bytes()
+	return result, nil
+}
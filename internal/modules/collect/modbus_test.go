@@ -0,0 +1,339 @@
+package collect
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"ultraphx-core/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	// config 包初始化时在当前目录生成的配置文件
+	os.RemoveAll("config")
+	os.Exit(code)
+}
+
+const (
+	big    = models.ModbusOrderBig
+	little = models.ModbusOrderLittle
+)
+
+func TestDecodeRegisters(t *testing.T) {
+	tests := []struct {
+		dataType  models.ModbusDataType
+		byteOrder models.ModbusOrder
+		wordOrder models.ModbusOrder
+		raw       []byte
+		want      float64
+	}{
+		{"", "", "", []byte{0x12, 0x34}, 0x1234},
+		{models.ModbusDataTypeUint16, big, big, []byte{0x12, 0x34}, 0x1234},
+		{models.ModbusDataTypeUint16, little, big, []byte{0x34, 0x12}, 0x1234},
+		{models.ModbusDataTypeUint16, big, little, []byte{0x12, 0x34}, 0x1234},
+		{models.ModbusDataTypeInt16, big, big, []byte{0xff, 0xfe}, -2},
+		{models.ModbusDataTypeInt16, little, big, []byte{0xfe, 0xff}, -2},
+		{models.ModbusDataTypeInt16, little, little, []byte{0xfe, 0xff}, -2},
+
+		// ABCD、CDAB、BADC、DCBA
+		{models.ModbusDataTypeUint32, big, big, []byte{0x12, 0x34, 0x56, 0x78}, 0x12345678},
+		{models.ModbusDataTypeUint32, big, little, []byte{0x56, 0x78, 0x12, 0x34}, 0x12345678},
+		{models.ModbusDataTypeUint32, little, big, []byte{0x34, 0x12, 0x78, 0x56}, 0x12345678},
+		{models.ModbusDataTypeUint32, little, little, []byte{0x78, 0x56, 0x34, 0x12}, 0x12345678},
+		{models.ModbusDataTypeInt32, big, big, []byte{0xff, 0xff, 0xff, 0xfe}, -2},
+		{models.ModbusDataTypeInt32, big, little, []byte{0xff, 0xfe, 0xff, 0xff}, -2},
+		{models.ModbusDataTypeInt32, little, big, []byte{0xff, 0xff, 0xfe, 0xff}, -2},
+		{models.ModbusDataTypeInt32, little, little, []byte{0xfe, 0xff, 0xff, 0xff}, -2},
+		{models.ModbusDataTypeFloat32, big, big, []byte{0x3f, 0xc0, 0x00, 0x00}, 1.5},
+		{models.ModbusDataTypeFloat32, big, little, []byte{0x00, 0x00, 0x3f, 0xc0}, 1.5},
+		{models.ModbusDataTypeFloat32, little, big, []byte{0xc0, 0x3f, 0x00, 0x00}, 1.5},
+		{models.ModbusDataTypeFloat32, little, little, []byte{0x00, 0x00, 0xc0, 0x3f}, 1.5},
+
+		{models.ModbusDataTypeUint64, big, big, []byte{1, 2, 3, 4, 5, 6, 7, 8}, 0x0102030405060708},
+		{models.ModbusDataTypeUint64, big, little, []byte{7, 8, 5, 6, 3, 4, 1, 2}, 0x0102030405060708},
+		{models.ModbusDataTypeUint64, little, big, []byte{2, 1, 4, 3, 6, 5, 8, 7}, 0x0102030405060708},
+		{models.ModbusDataTypeUint64, little, little, []byte{8, 7, 6, 5, 4, 3, 2, 1}, 0x0102030405060708},
+		{models.ModbusDataTypeInt64, big, big, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, -2},
+		{models.ModbusDataTypeInt64, big, little, []byte{0xff, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -2},
+		{models.ModbusDataTypeInt64, little, big, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe, 0xff}, -2},
+		{models.ModbusDataTypeInt64, little, little, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -2},
+		{models.ModbusDataTypeFloat64, big, big, []byte{0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, 1.5},
+		{models.ModbusDataTypeFloat64, big, little, []byte{0, 0, 0, 0, 0, 0, 0x3f, 0xf8}, 1.5},
+		{models.ModbusDataTypeFloat64, little, big, []byte{0xf8, 0x3f, 0, 0, 0, 0, 0, 0}, 1.5},
+		{models.ModbusDataTypeFloat64, little, little, []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}, 1.5},
+	}
+	for _, tt := range tests {
+		reg := models.ModbusRegister{DataType: tt.dataType, ByteOrder: tt.byteOrder, WordOrder: tt.wordOrder}
+		got, err := decodeRegisters(tt.raw, reg)
+		if err != nil {
+			t.Errorf("decodeRegisters(% x, %s %s/%s) error: %v", tt.raw, tt.dataType, tt.byteOrder, tt.wordOrder, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("decodeRegisters(% x, %s %s/%s) = %v, want %v", tt.raw, tt.dataType, tt.byteOrder, tt.wordOrder, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeRegistersErrors(t *testing.T) {
+	tests := []struct {
+		dataType models.ModbusDataType
+		raw      []byte
+	}{
+		{models.ModbusDataTypeUint16, []byte{0x12}},
+		{models.ModbusDataTypeFloat32, []byte{0x3f, 0xc0}},
+		{models.ModbusDataTypeFloat64, []byte{0x3f, 0xf8, 0, 0}},
+		{"string", []byte{0x12, 0x34}},
+	}
+	for _, tt := range tests {
+		if _, err := decodeRegisters(tt.raw, models.ModbusRegister{DataType: tt.dataType}); err == nil {
+			t.Errorf("decodeRegisters(% x, %s) returned no error", tt.raw, tt.dataType)
+		}
+	}
+}
+
+func TestValidateModbusCollection(t *testing.T) {
+	tests := []struct {
+		name      string
+		registers []models.ModbusRegister
+		valid     bool
+		is        error // 不为空时错误需要为该错误
+	}{
+		{"valid", []models.ModbusRegister{{Metric: "temperature"}, {Metric: "power", FunctionCode: 4, DataType: models.ModbusDataTypeFloat32}}, true, nil},
+		{"no registers", nil, false, errNoRegisters},
+		{"empty metric", []models.ModbusRegister{{Metric: "temperature"}, {Address: 2}}, false, errNoModbusMetric},
+		{"blank metric", []models.ModbusRegister{{Metric: "  "}}, false, errNoModbusMetric},
+		{"unsupported data type", []models.ModbusRegister{{Metric: "temperature", DataType: "string"}}, false, nil},
+		{"unsupported function code", []models.ModbusRegister{{Metric: "temperature", FunctionCode: 5}}, false, nil},
+	}
+	for _, tt := range tests {
+		err := Validate(&models.CollectionInfo{DataType: models.CollectionDataTypeModbus, Registers: tt.registers})
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: Validate = %v, want valid %v", tt.name, err, tt.valid)
+		}
+		if tt.is != nil && !errors.Is(err, tt.is) {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.is)
+		}
+	}
+
+	// 其他数据类型不需要寄存器表
+	if err := Validate(&models.CollectionInfo{DataType: models.CollectionDataTypeJSON}); err != nil {
+		t.Errorf("Validate json collection = %v", err)
+	}
+}
+
+// modbusSimulator 进程内的 Modbus TCP 从站，支持功能码 1 至 4
+type modbusSimulator struct {
+	listener  net.Listener
+	unitID    byte
+	coils     map[uint16]bool
+	registers map[uint16]uint16 // 保持寄存器与输入寄存器共用
+
+	mu       sync.Mutex
+	requests []byte // 收到的功能码
+}
+
+func startModbusSimulator(t *testing.T, unitID byte) *modbusSimulator {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &modbusSimulator{
+		listener:  l,
+		unitID:    unitID,
+		coils:     make(map[uint16]bool),
+		registers: make(map[uint16]uint16),
+	}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *modbusSimulator) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *modbusSimulator) handle(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		pdu := make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+		var reply []byte
+		if header[6] != s.unitID {
+			reply = []byte{pdu[0] | 0x80, 0x0b} // 目标设备无响应
+		} else {
+			reply = s.respond(pdu)
+		}
+		resp := make([]byte, 7, 7+len(reply))
+		copy(resp, header[:4])
+		binary.BigEndian.PutUint16(resp[4:], uint16(len(reply)+1))
+		resp[6] = header[6]
+		if _, err := conn.Write(append(resp, reply...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *modbusSimulator) respond(pdu []byte) []byte {
+	fc := pdu[0]
+	address := binary.BigEndian.Uint16(pdu[1:])
+	quantity := binary.BigEndian.Uint16(pdu[3:])
+	s.mu.Lock()
+	s.requests = append(s.requests, fc)
+	s.mu.Unlock()
+
+	switch fc {
+	case 1, 2:
+		data := make([]byte, (quantity+7)/8)
+		for i := uint16(0); i < quantity; i++ {
+			if s.coils[address+i] {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append([]byte{fc, byte(len(data))}, data...)
+	case 3, 4:
+		data := make([]byte, 0, quantity*2)
+		for i := uint16(0); i < quantity; i++ {
+			value, ok := s.registers[address+i]
+			if !ok {
+				return []byte{fc | 0x80, 0x02} // 非法数据地址
+			}
+			data = binary.BigEndian.AppendUint16(data, value)
+		}
+		return append([]byte{fc, byte(len(data))}, data...)
+	}
+	return []byte{fc | 0x80, 0x01} // 非法功能码
+}
+
+func (s *modbusSimulator) functionCodes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.requests...)
+}
+
+func TestPullModbus(t *testing.T) {
+	sim := startModbusSimulator(t, 7)
+	sim.coils[0] = true
+	sim.coils[1] = false
+	sim.registers[10] = 215 // 21.5 ℃
+	// float32 230.5，字序为低位在前
+	bits := math.Float32bits(230.5)
+	sim.registers[20] = uint16(bits)
+	sim.registers[21] = uint16(bits >> 16)
+	sim.registers[30] = 0xfffe
+
+	collection := &models.CollectionInfo{
+		DataType:           models.CollectionDataTypeModbus,
+		CollectionEndpoint: "tcp://" + sim.listener.Addr().String(),
+		UnitID:             7,
+		Registers: []models.ModbusRegister{
+			{Metric: "running", FunctionCode: 1, Address: 0},
+			{Metric: "alarm", FunctionCode: 2, Address: 1},
+			{Metric: "temperature", FunctionCode: 3, Address: 10, Scale: 0.1},
+			{Metric: "voltage", FunctionCode: 4, Address: 20, DataType: models.ModbusDataTypeFloat32, WordOrder: little},
+			{Metric: "offset", Address: 30, DataType: models.ModbusDataTypeInt16},
+		},
+	}
+	result, err := pullModbus(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"running":     1,
+		"alarm":       0,
+		"temperature": 21.5,
+		"voltage":     230.5,
+		"offset":      -2,
+	}
+	for metric, value := range want {
+		if got, ok := result.Data[metric]; !ok || math.Abs(got-value) > 1e-9 {
+			t.Errorf("%s = %v, want %v", metric, got, value)
+		}
+	}
+	if len(result.Data) != len(want) {
+		t.Errorf("data = %v, want %v", result.Data, want)
+	}
+	// 功能码为 0 时读取保持寄存器
+	if got, want := string(sim.functionCodes()), string([]byte{1, 2, 3, 4, 3}); got != want {
+		t.Errorf("function codes = %v, want %v", []byte(got), []byte(want))
+	}
+	if !strings.Contains(string(result.Raw), "temperature fc3@10: 00 d7") {
+		t.Errorf("raw response = %q", result.Raw)
+	}
+}
+
+func TestPullModbusErrors(t *testing.T) {
+	sim := startModbusSimulator(t, 1)
+	sim.registers[0] = 1
+	endpoint := sim.listener.Addr().String()
+
+	// 读取不存在的寄存器时返回异常响应，之前读到的原始数据仍然保留
+	result, err := pullModbus(&models.CollectionInfo{
+		CollectionEndpoint: endpoint,
+		UnitID:             1,
+		Registers: []models.ModbusRegister{
+			{Metric: "ok", Address: 0},
+			{Metric: "missing", Address: 100},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "register missing at 100") {
+		t.Errorf("pullModbus missing register error = %v", err)
+	}
+	if !strings.Contains(string(result.Raw), "ok fc0@0: 00 01") {
+		t.Errorf("raw response = %q", result.Raw)
+	}
+
+	// 从站地址不匹配
+	if _, err := pullModbus(&models.CollectionInfo{
+		CollectionEndpoint: endpoint,
+		UnitID:             2,
+		Registers:          []models.ModbusRegister{{Metric: "ok", Address: 0}},
+	}); err == nil {
+		t.Error("pullModbus with wrong unit id returned no error")
+	}
+
+	// 连接失败
+	sim.listener.Close()
+	if _, err := pullModbus(&models.CollectionInfo{
+		CollectionEndpoint: endpoint,
+		Registers:          []models.ModbusRegister{{Metric: "ok"}},
+	}); err == nil {
+		t.Error("pullModbus against closed port returned no error")
+	}
+}
+
+func TestModbusAddress(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"192.168.1.10", "192.168.1.10:502"},
+		{"192.168.1.10:1502", "192.168.1.10:1502"},
+		{"tcp://192.168.1.10", "192.168.1.10:502"},
+		{"modbus://plc.local:1502", "plc.local:1502"},
+	}
+	for _, tt := range tests {
+		if got := modbusAddress(tt.endpoint); got != tt.want {
+			t.Errorf("modbusAddress(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
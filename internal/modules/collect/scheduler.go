@@ -0,0 +1,202 @@
+package collect
+
+import (
+	"math/rand"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 主动采集调度
+//
+// 每个主动传感器在内存中维护一个定时器，到期后在全局与单主机的并发上限内执行采集，
+// 完成后按采集周期加随机抖动安排下一次。客户端新增、修改或删除后调用 Refresh 重新安排，
+// 不需要轮询数据库。上次采集时间只按 PersistInterval 的间隔写回数据库。
+const minCollectionPeriod = time.Second
+
+type collectJob struct {
+	client    models.Client
+	timer     *time.Timer
+	stopped   bool
+	persisted time.Time // 上次写回数据库的采集时间
+}
+
+type scheduler struct {
+	h   *hub.Hub
+	cfg *config.CollectConfig
+	sem chan struct{}
+
+	mu    sync.Mutex
+	jobs  map[string]*collectJob
+	hosts map[string]chan struct{}
+}
+
+var sched *scheduler
+
+func newScheduler(h *hub.Hub, cfg *config.CollectConfig) *scheduler {
+	return &scheduler{
+		h:     h,
+		cfg:   cfg,
+		sem:   make(chan struct{}, max(cfg.MaxConcurrency, 1)),
+		jobs:  make(map[string]*collectJob),
+		hosts: make(map[string]chan struct{}),
+	}
+}
+
+func collectionPeriod(collection *models.CollectionInfo) time.Duration {
+	return max(time.Duration(collection.CollectionPeriod)*time.Second, minCollectionPeriod)
+}
+
+// collectionHost 返回采集地址的主机，用于限制对同一设备的并发请求
+func collectionHost(collection *models.CollectionInfo) string {
+	if collection.DataType == models.CollectionDataTypeModbus {
+		if host, _, err := net.SplitHostPort(modbusAddress(collection.CollectionEndpoint)); err == nil {
+			return host
+		}
+	}
+	if u, err := url.Parse(collection.CollectionEndpoint); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	if collection.IPAddress != "" {
+		return collection.IPAddress
+	}
+	return collection.CollectionEndpoint
+}
+
+// jitter 返回不超过采集周期十分之一与 MaxJitter 的随机延迟，避免同周期的采集同时发生
+func (s *scheduler) jitter(period time.Duration) time.Duration {
+	limit := min(period/10, s.cfg.MaxJitter)
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+func (s *scheduler) hostSemaphore(host string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sem, ok := s.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, max(s.cfg.MaxPerHost, 1))
+		s.hosts[host] = sem
+	}
+	return sem
+}
+
+// schedule 安排客户端的采集，替换已有的安排，客户端不需要采集时只会停止已有的安排
+func (s *scheduler) schedule(client models.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unscheduleLocked(client.ID)
+	if client.Collection == nil || client.Status != models.ClientStatusActive || client.Type != models.ClientTypeSensorActive {
+		return
+	}
+
+	period := collectionPeriod(client.Collection)
+	delay := max(time.Until(client.Collection.LastCollectionTime.Add(period)), time.Until(tracker.suspendedUntil(client.ID)), 0)
+	job := &collectJob{
+		client:    client,
+		persisted: client.Collection.LastCollectionTime,
+	}
+	job.timer = time.AfterFunc(delay+s.jitter(period), func() {
+		s.run(job)
+	})
+	s.jobs[client.ID] = job
+}
+
+func (s *scheduler) unschedule(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unscheduleLocked(id)
+}
+
+func (s *scheduler) unscheduleLocked(id string) {
+	if job, ok := s.jobs[id]; ok {
+		job.stopped = true
+		job.timer.Stop()
+		delete(s.jobs, id)
+	}
+}
+
+func (s *scheduler) isStopped(job *collectJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return job.stopped
+}
+
+// run 执行一次采集并安排下一次，同一任务不会并发执行
+func (s *scheduler) run(job *collectJob) {
+	collection := job.client.Collection
+	hostSem := s.hostSemaphore(collectionHost(collection))
+	s.sem <- struct{}{}
+	hostSem <- struct{}{}
+	// 等待并发名额期间任务可能已被取消
+	if !s.isStopped(job) {
+		runCollect(&job.client, s.h)
+	}
+	<-hostSem
+	<-s.sem
+
+	if s.isStopped(job) {
+		return
+	}
+	if collection.LastCollectionTime.Sub(job.persisted) >= s.cfg.PersistInterval {
+		job.persisted = collection.LastCollectionTime
+		info := &models.CollectionInfo{ClientID: collection.ClientID}
+		if err := info.Query().Update("last_collection_time", job.persisted).Error; err != nil {
+			logrus.WithError(err).Error("Failed to update collection last collection time")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !job.stopped {
+		period := collectionPeriod(collection)
+		// 暂停期间不唤醒，直到暂停结束再尝试
+		delay := max(period+s.jitter(period), time.Until(tracker.suspendedUntil(collection.ClientID)))
+		job.timer.Reset(delay)
+	}
+}
+
+// load 安排数据库中全部启用的主动传感器
+func (s *scheduler) load() {
+	clients := make([]models.Client, 0)
+	err := (&models.Client{}).Query().
+		Where("status = ?", models.ClientStatusActive).
+		Where("type = ?", models.ClientTypeSensorActive).
+		Preload("Collection").
+		Find(&clients).Error
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load active sensors")
+		return
+	}
+	for _, client := range clients {
+		s.schedule(client)
+	}
+	logrus.Infof("Scheduled %d active sensors", len(clients))
+}
+
+// Refresh 重新读取客户端并安排采集，在客户端新增、修改或删除后调用，
+// 客户端已删除或不再需要采集时停止采集
+func Refresh(clientID string) {
+	if sched == nil {
+		return
+	}
+	clients := make([]models.Client, 0, 1)
+	if err := (&models.Client{}).Query().Where("id = ?", clientID).Preload("Collection").Find(&clients).Error; err != nil {
+		logrus.WithError(err).WithField("client", clientID).Error("Failed to load client for collection")
+		return
+	}
+	if len(clients) == 0 {
+		sched.unschedule(clientID)
+		tracker.remove(clientID)
+		return
+	}
+	sched.schedule(clients[0])
+}
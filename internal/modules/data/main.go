@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 	"ultraphx-core/internal/config"
@@ -18,6 +19,31 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Prometheus 文本格式中标签值需要转义的字符
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelName 将不能作为标签名的字符替换为 _
+func labelName(name string) string {
+	return sanitizeName(name, false)
+}
+
+// metricName 将不能作为指标名的字符替换为 _，例如 pm2.5 -> pm2_5，指标名可以包含 :
+func metricName(name string) string {
+	return sanitizeName(name, true)
+}
+
+func sanitizeName(name string, allowColon bool) string {
+	var b strings.Builder
+	for i, r := range name {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9' || allowColon && r == ':' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
 func ConvertToTimeSeries(rawData global.SensorData, meta map[string]string) (string, error) {
 	if len(rawData) == 0 {
 		return "", fmt.Errorf("rawData cannot be empty")
@@ -28,13 +54,17 @@ func ConvertToTimeSeries(rawData global.SensorData, meta map[string]string) (str
 	// Convert meta map to a formatted string of labels for Prometheus
 	var labels []string
 	for key, value := range meta {
-		labels = append(labels, fmt.Sprintf("%s=\"%s\"", key, value))
+		labels = append(labels, fmt.Sprintf("%s=\"%s\"", labelName(key), labelValueEscaper.Replace(value)))
 	}
+	sort.Strings(labels)
 	labelsString := "{" + strings.Join(labels, ",") + "}"
 
 	// Format each sensor data point as a Prometheus time series
 	for metric, value := range rawData {
-		result.WriteString(fmt.Sprintf("%s%s %f\n", metric, labelsString, value))
+		if metric == "" {
+			continue
+		}
+		result.WriteString(fmt.Sprintf("%s%s %f\n", metricName(metric), labelsString, value))
 	}
 
 	return result.String(), nil
@@ -48,12 +78,14 @@ func writeToVM(data string) {
 	req, err := http.NewRequest("POST", vmURL, bytes.NewBufferString(data))
 	if err != nil {
 		logrus.WithError(err).Error("Failed to create request")
+		return
 	}
 
 	req.Header.Set("Content-Type", "text/plain")
 	resp, err := client.Do(req)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to send request")
+		return
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode == http.StatusNoContent {
@@ -63,30 +95,50 @@ func writeToVM(data string) {
 	}
 }
 
+// buildImport 将 data 消息中的全部序列转换为一次导入的文本，
+// 序列的标签区分同一指标的不同序列，sensor_id 与 name 始终表示客户端
+func buildImport(payload *global.SensorDataPayload, sensorID, name string) string {
+	var result strings.Builder
+	for _, series := range payload.AllSeries() {
+		meta := make(map[string]string, len(series.Labels)+2)
+		for key, value := range series.Labels {
+			meta[key] = value
+		}
+		meta["sensor_id"] = sensorID
+		meta["name"] = name
+
+		timeSeriesData, err := ConvertToTimeSeries(series.Data, meta)
+		if err != nil {
+			continue
+		}
+		result.WriteString(timeSeriesData)
+	}
+	return result.String()
+}
+
 func handleDataListener(h *hub.Hub, msg *hub.Message) {
 	// logrus.Debug("Data message received", msg)
 	// handle data message
 	payload := global.ParseSensorDataPayload(msg.Payload)
+	if msg.Source == "" {
+		return
+	}
 
 	client := models.Client{
-		ID: payload.SenderID,
+		ID: msg.Source,
 	}
 	if err := client.Query().Find(&client).Error; err != nil {
 		logrus.WithError(err).Error("Failed to find client")
 		return
 	}
-	meta := map[string]string{
-		"sensor_id": payload.SenderID,
-		"name":      client.Name,
-	}
 
-	timeSeriesData, err := ConvertToTimeSeries(payload.Data, meta)
-	if err != nil {
-		logrus.WithError(err).Error("Failed to convert to time series")
+	timeSeriesData := buildImport(payload, msg.Source, client.Name)
+	if timeSeriesData == "" {
+		logrus.WithField("client_id", msg.Source).Warn("Data message has no metrics")
 		return
 	}
 
-	// send to vm
+	// 一条消息的全部序列一次写入 vm
 	writeToVM(timeSeriesData)
 }
 
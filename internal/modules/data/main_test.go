@@ -0,0 +1,215 @@
+package data
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/pkg/global"
+
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "data-test")
+	if err != nil {
+		panic(err)
+	}
+	config.GetDataBaseConfig().File = filepath.Join(dir, "database.db")
+	models.Setup()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	// config 与 auth 包初始化时在当前目录生成的配置文件与密钥
+	os.RemoveAll("config")
+	os.Exit(code)
+}
+
+// fakeVM 记录收到的导入请求
+type fakeVM struct {
+	mu      sync.Mutex
+	imports []string
+}
+
+func startFakeVM(t *testing.T) *fakeVM {
+	t.Helper()
+	vm := &fakeVM{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/import/prometheus" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		vm.mu.Lock()
+		vm.imports = append(vm.imports, string(body))
+		vm.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := config.GetVmDBConfig()
+	url := cfg.Url
+	cfg.Url = server.URL
+	t.Cleanup(func() { cfg.Url = url })
+	return vm
+}
+
+func (vm *fakeVM) requests() []string {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	return append([]string(nil), vm.imports...)
+}
+
+func sortedLines(s string) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestConvertToTimeSeriesEscapesLabels(t *testing.T) {
+	got, err := ConvertToTimeSeries(global.SensorData{"temperature": 21.5}, map[string]string{
+		"name":       `Lab "A"`,
+		"path":       `C:\sensors`,
+		"note":       "line1\nline2",
+		"device.id":  "1",
+		"1st":        "x",
+		"sensor_id":  "s1",
+		"ok_label_2": "y",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `temperature{_st="x",device_id="1",name="Lab \"A\"",note="line1\nline2",ok_label_2="y",path="C:\\sensors",sensor_id="s1"} 21.500000` + "\n"
+	if got != want {
+		t.Errorf("ConvertToTimeSeries =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := ConvertToTimeSeries(global.SensorData{}, nil); err == nil {
+		t.Error("ConvertToTimeSeries with no data returned no error")
+	}
+}
+
+func TestConvertToTimeSeriesSanitizesMetricNames(t *testing.T) {
+	tests := []struct {
+		metric string
+		want   string
+	}{
+		{"temperature", "temperature"},
+		{"pm2.5", "pm2_5"},
+		{"device name", "device_name"},
+		{"ENERGY-Power", "ENERGY_Power"},
+		{"2nd", "_nd"},
+		{"node:cpu:rate5m", "node:cpu:rate5m"},
+		{"温度", "__"},
+		{`a{b="c"}`, "a_b__c__"},
+	}
+	for _, tt := range tests {
+		got, err := ConvertToTimeSeries(global.SensorData{tt.metric: 1}, map[string]string{"sensor_id": "s1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tt.want + `{sensor_id="s1"} 1.000000` + "\n"; got != want {
+			t.Errorf("ConvertToTimeSeries(%q) = %q, want %q", tt.metric, got, want)
+		}
+	}
+
+	// 没有名称的指标被跳过
+	got, err := ConvertToTimeSeries(global.SensorData{"": 1, "ok": 2}, nil)
+	if err != nil || got != "ok{} 2.000000\n" {
+		t.Errorf("ConvertToTimeSeries with empty metric name = %q, %v", got, err)
+	}
+}
+
+func TestBuildImport(t *testing.T) {
+	series := []global.SensorSeries{
+		{Labels: map[string]string{"cpu": "0", "mode": "idle"}, Data: global.SensorData{"node_cpu_seconds_total": 10}},
+		{Labels: map[string]string{"cpu": "1", "mode": "idle"}, Data: global.SensorData{"node_cpu_seconds_total": 20}},
+		// 序列中的 sensor_id 与 name 不能覆盖客户端
+		{Labels: map[string]string{"sensor_id": "other", "name": "other"}, Data: global.SensorData{"up": 1}},
+		{Labels: map[string]string{"empty": "1"}},
+	}
+	want := []string{
+		`node_cpu_seconds_total{cpu="0",mode="idle",name="node",sensor_id="s1"} 10.000000`,
+		`node_cpu_seconds_total{cpu="1",mode="idle",name="node",sensor_id="s1"} 20.000000`,
+		`temperature{name="node",room="a",sensor_id="s1"} 21.500000`,
+		`up{name="node",sensor_id="s1"} 1.000000`,
+	}
+
+	// 进程内发布的消息与经过 JSON 编码的消息应当得到相同的结果
+	payload := map[string]interface{}{
+		"data":   global.SensorData{"temperature": 21.5},
+		"labels": map[string]string{"room": "a"},
+		"series": series,
+	}
+	encoded, _ := json.Marshal(payload)
+	decoded := make(map[string]interface{})
+	json.Unmarshal(encoded, &decoded)
+
+	for name, p := range map[string]map[string]interface{}{"in-process": payload, "json": decoded} {
+		got := sortedLines(buildImport(global.ParseSensorDataPayload(p), "s1", "node"))
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: buildImport =\n%s\nwant\n%s", name, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+func TestHandleDataListenerWritesOnce(t *testing.T) {
+	vm := startFakeVM(t)
+	client := models.Client{ID: uuid.New().String(), Name: "node"}
+	if err := client.Query().Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 一次抓取的大量序列只写入一次
+	const n = 2000
+	series := make([]global.SensorSeries, 0, n)
+	for i := 0; i < n; i++ {
+		series = append(series, global.SensorSeries{
+			Labels: map[string]string{"id": uuid.New().String()},
+			Data:   global.SensorData{"value": float64(i)},
+		})
+	}
+	handleDataListener(nil, &hub.Message{
+		Topic:   "data",
+		Source:  client.ID,
+		Payload: map[string]interface{}{"series": series},
+	})
+
+	requests := vm.requests()
+	if len(requests) != 1 {
+		t.Fatalf("VM received %d imports, want 1", len(requests))
+	}
+	if lines := strings.Count(requests[0], "\n"); lines != n {
+		t.Errorf("import has %d lines, want %d", lines, n)
+	}
+
+	// 没有指标的消息不写入
+	handleDataListener(nil, &hub.Message{Topic: "data", Source: client.ID, Payload: map[string]interface{}{}})
+	if len(vm.requests()) != 1 {
+		t.Error("empty data message was written to VM")
+	}
+}
+
+func TestWriteToVMErrors(t *testing.T) {
+	cfg := config.GetVmDBConfig()
+	url := cfg.Url
+	defer func() { cfg.Url = url }()
+
+	// 无效地址与无法连接时只记录错误
+	cfg.Url = "http://[::1"
+	writeToVM("up 1\n")
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	cfg.Url = server.URL
+	server.Close()
+	writeToVM("up 1\n")
+}
@@ -0,0 +1,44 @@
+package retain
+
+import (
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/services/auth"
+	"ultraphx-core/pkg/resp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 获取保留消息，只返回客户端有读权限的主题
+func GetRetainedMessages(c *gin.Context, h *hub.Hub) {
+	filter := c.DefaultQuery("filter", hub.TopicWildcardML)
+	if err := hub.ValidateTopicFilter(filter); err != nil {
+		resp.Error(c, "Invalid filter")
+		return
+	}
+
+	permissions := auth.HubPermissions(c.MustGet("client").(*models.Client))
+	messages := make([]*hub.Message, 0)
+	for _, msg := range h.Retained(filter) {
+		if permissions.CanRead(msg.Topic) {
+			messages = append(messages, msg)
+		}
+	}
+	resp.OK(c, resp.H{
+		"messages": messages,
+	})
+}
+
+// 清除保留消息，只清除客户端有写权限的主题
+func ClearRetainedMessages(c *gin.Context, h *hub.Hub) {
+	filter := c.Query("filter")
+	if err := hub.ValidateTopicFilter(filter); err != nil {
+		resp.Error(c, "Invalid filter")
+		return
+	}
+
+	permissions := auth.HubPermissions(c.MustGet("client").(*models.Client))
+	resp.OK(c, resp.H{
+		"cleared": h.ClearRetained(filter, permissions.CanWrite),
+	})
+}
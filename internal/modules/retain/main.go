@@ -0,0 +1,30 @@
+package retain
+
+import (
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/router"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func Setup(h *hub.Hub) {
+	if config.GetHubConfig().PersistRetained {
+		models.AutoMigrate(&RetainedMessage{})
+		if err := h.SetRetainStore(dbStore{}); err != nil {
+			logrus.WithError(err).Error("Failed to load retained messages")
+		}
+	}
+
+	authRouter := router.GetAuthRouter()
+	authRouter.GET("/hub/retained", func(c *gin.Context) {
+		GetRetainedMessages(c, h)
+	})
+	authRouter.DELETE("/hub/retained", func(c *gin.Context) {
+		ClearRetainedMessages(c, h)
+	})
+
+	logrus.Info("Retain module ready")
+}
@@ -0,0 +1,52 @@
+package retain
+
+import (
+	"time"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// RetainedMessage 持久化的保留消息，每个主题一条
+type RetainedMessage struct {
+	Topic     string    `gorm:"primarykey" json:"topic"`
+	Data      string    `json:"data"` // 序列化后的 hub.Message
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (r *RetainedMessage) Query() *gorm.DB {
+	return models.DB.Model(r)
+}
+
+// dbStore 基于数据库的 hub.RetainStore 实现
+type dbStore struct{}
+
+func (dbStore) Load() ([]*hub.Message, error) {
+	var records []RetainedMessage
+	if err := (&RetainedMessage{}).Query().Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	messages := make([]*hub.Message, 0, len(records))
+	for _, record := range records {
+		msg, err := hub.PraseMessageStr(record.Data)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (dbStore) Save(msg *hub.Message) error {
+	record := RetainedMessage{
+		Topic: msg.Topic,
+		Data:  string(msg.ToJson()),
+	}
+	return record.Query().Save(&record).Error
+}
+
+func (dbStore) Delete(topic string) error {
+	return (&RetainedMessage{}).Query().Where("topic = ?", topic).Delete(&RetainedMessage{}).Error
+}
@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/pkg/resp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func checkSchema(s *TopicSchema) error {
+	if err := hub.ValidateTopicFilter(s.Topic); err != nil {
+		return err
+	}
+	_, err := compile(s.Name, s.Schema)
+	return err
+}
+
+func reload() {
+	if err := schemaRegistry.Reload(); err != nil {
+		logrus.WithError(err).Error("Failed to reload schemas")
+	}
+}
+
+func GetSchemas(c *gin.Context) {
+	var schemas []TopicSchema
+	if err := (&TopicSchema{}).Query().Find(&schemas).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+
+	resp.OK(c, resp.H{
+		"schemas": schemas,
+	})
+}
+
+func AddSchema(c *gin.Context) {
+	var schema TopicSchema
+	if err := c.ShouldBindJSON(&schema); err != nil {
+		resp.Error(c, "Invalid request")
+		return
+	}
+	if err := checkSchema(&schema); err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	schema.ID = uuid.New().String()
+
+	if err := schema.Query().Create(&schema).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	reload()
+
+	resp.OK(c, resp.H{
+		"schema": schema,
+	})
+}
+
+func UpdateSchema(c *gin.Context) {
+	var schema TopicSchema
+	if err := c.ShouldBindJSON(&schema); err != nil || schema.ID == "" {
+		resp.Error(c, "Invalid request")
+		return
+	}
+	if err := checkSchema(&schema); err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+
+	if err := schema.Query().Save(&schema).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	reload()
+
+	resp.OK(c, resp.H{
+		"schema": schema,
+	})
+}
+
+func DeleteSchema(c *gin.Context) {
+	id := c.Query("id")
+	if err := (&TopicSchema{}).Query().Where("id = ?", id).Delete(&TopicSchema{}).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	reload()
+
+	resp.OK(c, nil)
+}
+
+// ValidateMessage 使用已注册的 Schema 校验消息，不会发布消息
+func ValidateMessage(c *gin.Context) {
+	var msg hub.Message
+	if err := c.ShouldBindJSON(&msg); err != nil {
+		resp.Error(c, "Invalid request")
+		return
+	}
+
+	if err := schemaRegistry.Validate(&msg); err != nil {
+		resp.OK(c, resp.H{
+			"valid": false,
+			"error": err.Error(),
+		})
+		return
+	}
+	resp.OK(c, resp.H{
+		"valid": true,
+	})
+}
@@ -0,0 +1,24 @@
+package schema
+
+import (
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/router"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Setup(h *hub.Hub) {
+	models.AutoMigrate(&TopicSchema{})
+	reload()
+	h.SetValidator(schemaRegistry)
+
+	authRouter := router.GetAuthRouter()
+	authRouter.GET("/hub/schemas", GetSchemas)
+	authRouter.POST("/hub/schema", AddSchema)
+	authRouter.PUT("/hub/schema", UpdateSchema)
+	authRouter.DELETE("/hub/schema", DeleteSchema)
+	authRouter.POST("/hub/schema/validate", ValidateMessage)
+
+	logrus.Info("Schema module ready")
+}
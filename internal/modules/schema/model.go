@@ -0,0 +1,21 @@
+package schema
+
+import (
+	"encoding/json"
+	"ultraphx-core/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// TopicSchema 与主题绑定的 JSON Schema，用于校验消息的 Payload
+type TopicSchema struct {
+	models.Model
+	Name        string          `json:"name" binding:"required"`
+	Topic       string          `json:"topic" binding:"required"` // 主题，支持通配符
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema" binding:"required" gorm:"type:text"`
+}
+
+func (s *TopicSchema) Query() *gorm.DB {
+	return models.DB.Model(s)
+}
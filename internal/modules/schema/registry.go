@@ -0,0 +1,99 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"ultraphx-core/internal/hub"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/sirupsen/logrus"
+)
+
+type compiledSchema struct {
+	name   string
+	topic  string
+	schema *jsonschema.Schema
+}
+
+// registry 实现 hub.Validator，消息需要通过全部匹配主题的 Schema
+type registry struct {
+	mu      sync.RWMutex
+	schemas []compiledSchema
+}
+
+var schemaRegistry = &registry{}
+
+func compile(name string, doc []byte) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	url := "schema://" + name
+	if err := compiler.AddResource(url, bytes.NewReader(doc)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(url)
+}
+
+// Reload 从数据库重新加载全部 Schema，无法编译的 Schema 会被跳过
+func (r *registry) Reload() error {
+	var records []TopicSchema
+	if err := (&TopicSchema{}).Query().Find(&records).Error; err != nil {
+		return err
+	}
+
+	schemas := make([]compiledSchema, 0, len(records))
+	for _, record := range records {
+		schema, err := compile(record.ID, record.Schema)
+		if err != nil {
+			// 一个 Schema 无效时仍然加载其他 Schema，避免全部校验失效
+			logrus.WithError(err).WithField("schema", record.Name).Error("Failed to compile schema, skipped")
+			continue
+		}
+		schemas = append(schemas, compiledSchema{
+			name:   record.Name,
+			topic:  record.Topic,
+			schema: schema,
+		})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas = schemas
+	return nil
+}
+
+func (r *registry) Validate(msg *hub.Message) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var payload interface{}
+	for _, s := range r.schemas {
+		if !hub.MatchTopic(s.topic, msg.Topic) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = normalize(msg.Payload); err != nil {
+				return fmt.Errorf("%w: %s", hub.ErrInvalidPayload, err)
+			}
+		}
+		if err := s.schema.Validate(payload); err != nil {
+			return fmt.Errorf("%w: schema %s: %s", hub.ErrInvalidPayload, s.name, err)
+		}
+	}
+	return nil
+}
+
+// normalize 将 Payload 转换为 JSON 解码后的通用类型
+func normalize(payload map[string]interface{}) (interface{}, error) {
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "schema-test")
+	if err != nil {
+		panic(err)
+	}
+	config.GetDataBaseConfig().File = filepath.Join(dir, "database.db")
+	models.Setup()
+	models.AutoMigrate(&TopicSchema{})
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	// config 包初始化时在当前目录生成的配置文件
+	os.RemoveAll("config")
+	os.Exit(code)
+}
+
+func TestReloadSkipsInvalidSchema(t *testing.T) {
+	// 直接写入数据库，模拟升级前保存或被手动修改的无效 Schema
+	records := []TopicSchema{
+		{Name: "broken", Topic: "data::#", Schema: []byte(`{"type": 1}`)},
+		{Name: "temperature", Topic: "data::+::temp", Schema: []byte(`{"type": "object", "required": ["value"]}`)},
+	}
+	for i := range records {
+		records[i].ID = uuid.New().String()
+		if err := records[i].Query().Create(&records[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+		defer records[i].Query().Where("id = ?", records[i].ID).Delete(&TopicSchema{})
+	}
+
+	r := &registry{}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload = %v, want nil", err)
+	}
+	if len(r.schemas) != 1 || r.schemas[0].name != "temperature" {
+		t.Fatalf("loaded schemas = %+v, want only temperature", r.schemas)
+	}
+
+	err := r.Validate(&hub.Message{Topic: "data::s1::temp", Payload: map[string]interface{}{}})
+	if !errors.Is(err, hub.ErrInvalidPayload) {
+		t.Errorf("Validate invalid payload = %v, want %v", err, hub.ErrInvalidPayload)
+	}
+	err = r.Validate(&hub.Message{Topic: "data::s1::temp", Payload: map[string]interface{}{"value": 21.5}})
+	if err != nil {
+		t.Errorf("Validate valid payload = %v", err)
+	}
+}
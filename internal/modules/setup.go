@@ -6,11 +6,15 @@ import (
 	"ultraphx-core/internal/modules/camera"
 	"ultraphx-core/internal/modules/collect"
 	"ultraphx-core/internal/modules/data"
+	"ultraphx-core/internal/modules/retain"
+	"ultraphx-core/internal/modules/schema"
 )
 
 func Setup(h *hub.Hub) {
+	schema.Setup(h)
 	data.Setup()
 	alert.Setup()
 	camera.Setup()
 	collect.Setup(h)
+	retain.Setup(h)
 }
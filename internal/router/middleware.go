@@ -35,7 +35,7 @@ func AuthMiddleware(c *gin.Context) {
 		ID: claims.ClientID,
 	}
 
-	if err := client.Query().Find(&client).Error; err != nil {
+	if err := client.Query().Preload("Permissions").Find(&client).Error; err != nil {
 		logrus.WithError(err).Error("Failed to find client")
 		resp.ErrorWithCode(c, http.StatusUnauthorized, "Unauthorized")
 		return
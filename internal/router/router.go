@@ -37,6 +37,16 @@ func init() {
 	authRouter.POST("/client/remove_client", api.RemoveClient)
 	authRouter.POST("/client/set_client_status", api.SetClientStatus)
 	authRouter.POST("/client/scan_active_sensor", api.ScanActiveSensor)
+	authRouter.GET("/client/discovered_devices", api.GetDiscoveredDevices)
+	authRouter.GET("/client/scan_jobs", api.GetScanJobs)
+	authRouter.POST("/client/scan_job", api.StartScanJob)
+	authRouter.GET("/client/scan_job", api.GetScanJob)
+	authRouter.DELETE("/client/scan_job", api.CancelScanJob)
+	authRouter.POST("/client/adopt_sensor", api.AdoptSensor)
+	authRouter.POST("/client/adopt_sensors", api.AdoptSensors)
+	authRouter.GET("/client/collect_status", api.GetCollectStatus)
+	authRouter.POST("/client/collect_now", api.CollectNow)
+	authRouter.POST("/client/test_collection", api.TestCollection)
 
 	apiRouter.POST("/client/local_client/setup", api.SetupLocalClient)
 	apiRouter.POST("/client/local_client/login", api.LoginLocalClient)
@@ -0,0 +1,68 @@
+package servers
+
+import (
+	"errors"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/services/auth"
+
+	"github.com/sirupsen/logrus"
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// authenticateToken 校验 JWT 并返回处于激活状态的客户端，用于无法经过 AuthMiddleware 的协议
+func authenticateToken(token string) (*models.Client, error) {
+	claims, err := auth.ParseJWTToken(token)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+	client := models.Client{
+		ID: claims.ClientID,
+	}
+	if err := client.Query().Preload("Permissions").Find(&client).Error; err != nil {
+		logrus.WithError(err).Error("Failed to find client")
+		return nil, errUnauthorized
+	}
+	client.CheckIsExpired()
+	if client.Status != models.ClientStatusActive {
+		return nil, errUnauthorized
+	}
+	return &client, nil
+}
+
+// defaultClientOptions 由配置文件决定的客户端发送队列参数
+func defaultClientOptions() hub.ClientOptions {
+	cfg := config.GetHubConfig()
+	return hub.ClientOptions{
+		QueueSize:      cfg.QueueSize,
+		OverflowPolicy: hub.OverflowPolicy(cfg.OverflowPolicy),
+	}
+}
+
+// newHubClient 创建携带客户端授权的 hub 客户端
+func newHubClient(h *hub.Hub, client *models.Client, opts hub.ClientOptions) *hub.Client {
+	hubClient := hub.NewClientWithOptions("", h, opts)
+	hubClient.Source = client.ID
+	hubClient.Permissions = auth.HubPermissions(client)
+	return hubClient
+}
+
+// mqttPermissions 来自 MQTT 的消息没有客户端身份，其权限由配置决定
+func mqttPermissions() hub.Permissions {
+	cfg := config.GetMqttConfig()
+	permissions := make(hub.Permissions, 0, len(cfg.Permissions))
+	for _, s := range cfg.Permissions {
+		p, err := models.PrasePermission(s)
+		if err != nil {
+			logrus.WithField("permission", s).Warn("Invalid MQTT permission")
+			continue
+		}
+		permissions = append(permissions, hub.Permission{
+			Topic: p.Topic,
+			Type:  hub.PermissionType(p.Type),
+		})
+	}
+	return permissions
+}
@@ -0,0 +1,289 @@
+package servers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+
+	"github.com/fxamacker/cbor/v2"
+	coapMessage "github.com/plgd-dev/go-coap/v3/message"
+	"github.com/plgd-dev/go-coap/v3/message/codes"
+	"github.com/plgd-dev/go-coap/v3/mux"
+	coapNet "github.com/plgd-dev/go-coap/v3/net"
+	"github.com/plgd-dev/go-coap/v3/options"
+	"github.com/plgd-dev/go-coap/v3/udp"
+	udpServer "github.com/plgd-dev/go-coap/v3/udp/server"
+	"github.com/sirupsen/logrus"
+)
+
+// CoAP 服务
+//
+//	POST coap://host:5683/data?token=...            发布到 data
+//	POST coap://host:5683/event/button?token=...    发布到 event::button
+//	GET  coap://host:5683/command?token=... (Observe: 0)
+//
+// 资源路径的每一级对应 hub 主题的一级，负载为 JSON 对象或 CBOR map，由 Content-Format 区分，默认为 JSON。
+// 观察 command 资源的设备会收到发往 command::<客户端 ID> 及其子主题的消息，
+// 通知的格式由请求的 Accept 决定，默认为 JSON。
+const coapCommandResource = "command"
+
+var (
+	errUnsupportedFormat = errors.New("unsupported content format")
+
+	cborDecMode, _ = cbor.DecOptions{
+		DefaultMapType: reflect.TypeOf(map[string]interface{}{}),
+	}.DecMode()
+)
+
+type coapServer struct {
+	h *hub.Hub
+
+	mu        sync.Mutex
+	observers map[string]*hub.Client // 以远端地址与 token 区分观察者
+}
+
+func newCoapServer(h *hub.Hub) *coapServer {
+	return &coapServer{
+		h:         h,
+		observers: make(map[string]*hub.Client),
+	}
+}
+
+// coapToken 从 Uri-Query 中读取 token
+func coapToken(r *mux.Message) string {
+	queries, err := r.Queries()
+	if err != nil {
+		return ""
+	}
+	for _, query := range queries {
+		if token, ok := strings.CutPrefix(query, "token="); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+// coapTopic 将资源路径转换为 hub 主题，例如 /event/button -> event::button
+func coapTopic(r *mux.Message) string {
+	path, err := r.Path()
+	if err != nil {
+		return ""
+	}
+	return strings.ReplaceAll(strings.Trim(path, "/"), "/", hub.TopicSeparator)
+}
+
+func decodeCoapPayload(format coapMessage.MediaType, body []byte) (map[string]interface{}, error) {
+	payload := make(map[string]interface{})
+	if len(body) == 0 {
+		return payload, nil
+	}
+	switch format {
+	case coapMessage.AppJSON:
+		return payload, json.Unmarshal(body, &payload)
+	case coapMessage.AppCBOR:
+		return payload, cborDecMode.Unmarshal(body, &payload)
+	}
+	return nil, errUnsupportedFormat
+}
+
+func encodeCoapMessage(format coapMessage.MediaType, msg *hub.Message) ([]byte, coapMessage.MediaType) {
+	if format == coapMessage.AppCBOR {
+		if data, err := cbor.Marshal(msg); err == nil {
+			return data, coapMessage.AppCBOR
+		}
+	}
+	return msg.ToJson(), coapMessage.AppJSON
+}
+
+func (s *coapServer) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	// 取消观察只影响请求方自己的观察，不需要认证
+	if obs, err := r.Observe(); err == nil && obs == 1 && r.Code() == codes.GET {
+		s.cancelObserve(w.Conn(), r.Token())
+		w.SetResponse(codes.Content, coapMessage.AppJSON, nil)
+		return
+	}
+
+	client, err := authenticateToken(coapToken(r))
+	if err != nil {
+		w.SetResponse(codes.Unauthorized, coapMessage.TextPlain, nil)
+		return
+	}
+	topic := coapTopic(r)
+
+	switch r.Code() {
+	case codes.POST, codes.PUT:
+		s.publish(w, r, client, topic)
+	case codes.GET:
+		if topic != coapCommandResource {
+			w.SetResponse(codes.NotFound, coapMessage.TextPlain, nil)
+			return
+		}
+		if obs, err := r.Observe(); err == nil && obs == 0 {
+			s.observe(w, r, client)
+			return
+		}
+		w.SetResponse(codes.Content, coapMessage.AppJSON, nil)
+	default:
+		w.SetResponse(codes.MethodNotAllowed, coapMessage.TextPlain, nil)
+	}
+}
+
+// publish 以客户端身份发布请求中的负载
+func (s *coapServer) publish(w mux.ResponseWriter, r *mux.Message, client *models.Client, topic string) {
+	format, err := r.ContentFormat()
+	if err != nil {
+		format = coapMessage.AppJSON
+	}
+	body, err := r.ReadBody()
+	if err != nil {
+		w.SetResponse(codes.BadRequest, coapMessage.TextPlain, nil)
+		return
+	}
+	payload, err := decodeCoapPayload(format, body)
+	if errors.Is(err, errUnsupportedFormat) {
+		w.SetResponse(codes.UnsupportedMediaType, coapMessage.TextPlain, nil)
+		return
+	}
+	if err != nil {
+		w.SetResponse(codes.BadRequest, coapMessage.TextPlain, bytes.NewReader([]byte(err.Error())))
+		return
+	}
+
+	hubClient := newHubClient(s.h, client, defaultClientOptions())
+	err = hubClient.Broadcast(&hub.Message{
+		Topic:   topic,
+		Payload: payload,
+	})
+	switch {
+	case errors.Is(err, hub.ErrPermissionDenied):
+		w.SetResponse(codes.Forbidden, coapMessage.TextPlain, nil)
+	case err != nil:
+		w.SetResponse(codes.BadRequest, coapMessage.TextPlain, bytes.NewReader([]byte(err.Error())))
+	default:
+		w.SetResponse(codes.Changed, coapMessage.TextPlain, nil)
+	}
+}
+
+func observerKey(cc mux.Conn, token coapMessage.Token) string {
+	return cc.RemoteAddr().String() + "/" + token.String()
+}
+
+// observe 订阅客户端的命令主题，并将收到的消息作为通知发送给设备
+func (s *coapServer) observe(w mux.ResponseWriter, r *mux.Message, client *models.Client) {
+	accept, err := r.Accept()
+	if err != nil {
+		accept = coapMessage.AppJSON
+	}
+	cc := w.Conn()
+	token := append(coapMessage.Token{}, r.Token()...)
+
+	// 设备总是可以读取发给自己的命令，默认的传感器权限中没有该授权
+	commandTopic := coapCommandResource + hub.TopicSeparator + client.ID + hub.TopicSeparator + hub.TopicWildcardML
+	hubClient := newHubClient(s.h, client, defaultClientOptions())
+	hubClient.Permissions = append(hub.Permissions{
+		{Topic: commandTopic, Type: hub.PermissionTypeRead},
+	}, hubClient.Permissions...)
+	if err := hubClient.Subscribe(commandTopic); err != nil {
+		w.SetResponse(codes.Forbidden, coapMessage.TextPlain, nil)
+		return
+	}
+	s.h.Register(hubClient)
+	key := observerKey(cc, token)
+	s.mu.Lock()
+	if previous, ok := s.observers[key]; ok {
+		s.h.Unregister(previous)
+	}
+	s.observers[key] = hubClient
+	s.mu.Unlock()
+
+	w.SetResponse(codes.Content, accept, nil, coapMessage.Option{
+		ID:    coapMessage.Observe,
+		Value: []byte{1},
+	})
+	go s.notify(cc, token, accept, hubClient)
+	logrus.WithField("client_id", client.ID).WithField("remote", cc.RemoteAddr().String()).Info("CoAP observer registered")
+}
+
+func (s *coapServer) notify(cc mux.Conn, token coapMessage.Token, accept coapMessage.MediaType, hubClient *hub.Client) {
+	defer s.removeObserver(observerKey(cc, token), hubClient)
+	seq := uint32(2)
+	for {
+		select {
+		case msg, ok := <-hubClient.SendChan:
+			if !ok {
+				return
+			}
+			body, format := encodeCoapMessage(accept, msg)
+			m := cc.AcquireMessage(cc.Context())
+			m.SetCode(codes.Content)
+			m.SetToken(token)
+			m.SetContentFormat(format)
+			m.SetObserve(seq)
+			m.SetBody(bytes.NewReader(body))
+			err := cc.WriteMessage(m)
+			cc.ReleaseMessage(m)
+			if err != nil {
+				logrus.WithError(err).Debug("Failed to send CoAP notification")
+				return
+			}
+			seq++
+		case <-cc.Done():
+			return
+		}
+	}
+}
+
+// removeObserver 移除仍然指向 hubClient 的观察者，观察者可能已被同一 token 的新观察替换
+func (s *coapServer) removeObserver(key string, hubClient *hub.Client) {
+	s.mu.Lock()
+	current, ok := s.observers[key]
+	if ok && current == hubClient {
+		delete(s.observers, key)
+	}
+	s.mu.Unlock()
+	s.h.Unregister(hubClient)
+}
+
+func (s *coapServer) cancelObserve(cc mux.Conn, token coapMessage.Token) {
+	key := observerKey(cc, token)
+	s.mu.Lock()
+	hubClient, ok := s.observers[key]
+	delete(s.observers, key)
+	s.mu.Unlock()
+	if ok {
+		s.h.Unregister(hubClient)
+	}
+}
+
+// newCoapListener 创建 CoAP 服务与 UDP 监听
+func newCoapListener(h *hub.Hub, addr string) (*udpServer.Server, *coapNet.UDPConn, error) {
+	l, err := coapNet.NewListenUDP("udp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return udp.NewServer(options.WithMux(newCoapServer(h))), l, nil
+}
+
+// ServeCoAP 启动 CoAP 服务
+func ServeCoAP(h *hub.Hub) {
+	cfg := config.GetCoapConfig()
+	if !cfg.Enabled {
+		return
+	}
+	server, l, err := newCoapListener(h, ":"+cfg.Port)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to listen CoAP")
+		return
+	}
+	defer l.Close()
+	logrus.Info("Starting CoAP server on :" + cfg.Port)
+	if err := server.Serve(l); err != nil {
+		logrus.WithError(err).Error("Failed to start CoAP server")
+	}
+}
@@ -0,0 +1,216 @@
+package servers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/services/auth"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	coapMessage "github.com/plgd-dev/go-coap/v3/message"
+	"github.com/plgd-dev/go-coap/v3/message/codes"
+	"github.com/plgd-dev/go-coap/v3/message/pool"
+	"github.com/plgd-dev/go-coap/v3/udp"
+	udpClient "github.com/plgd-dev/go-coap/v3/udp/client"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "servers-test")
+	if err != nil {
+		panic(err)
+	}
+	config.GetDataBaseConfig().File = filepath.Join(dir, "database.db")
+	models.Setup()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	// config 与 auth 包初始化时在当前目录生成的配置文件与密钥
+	os.RemoveAll("config")
+	os.Exit(code)
+}
+
+// newTestSensor 创建传感器客户端并返回其 token
+func newTestSensor(t *testing.T, topics ...string) (*models.Client, string) {
+	t.Helper()
+	client := models.Client{
+		ID:     uuid.New().String(),
+		Name:   "coap-sensor",
+		Status: models.ClientStatusActive,
+		Type:   models.ClientTypeSensor,
+	}
+	for _, topic := range topics {
+		client.Permissions = append(client.Permissions, models.Permission{
+			Model: models.Model{ID: uuid.New().String()},
+			Topic: topic,
+			Type:  models.PermissionTypeWrite,
+		})
+	}
+	if err := client.Query().Create(&client).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.CreateJWTToken(auth.JwtPayload{ClientID: client.ID, Type: client.Type})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client, token
+}
+
+// startCoap 在回环地址上启动 CoAP 服务并返回连接到该服务的客户端
+func startCoap(t *testing.T, h *hub.Hub) *udpClient.Conn {
+	t.Helper()
+	server, l, err := newCoapListener(h, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	t.Cleanup(func() {
+		server.Stop()
+		l.Close()
+	})
+
+	co, err := udp.Dial(l.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { co.Close() })
+	return co
+}
+
+func tokenQuery(token string) coapMessage.Option {
+	return coapMessage.Option{ID: coapMessage.URIQuery, Value: []byte("token=" + token)}
+}
+
+func newTestHub() *hub.Hub {
+	h := hub.NewHub()
+	go h.Run()
+	return h
+}
+
+func TestCoapPublish(t *testing.T) {
+	h := newTestHub()
+	co := startCoap(t, h)
+	client, token := newTestSensor(t, "data")
+
+	received := make(chan *hub.Message, 4)
+	id := hub.AddTopicListener("data", func(h *hub.Hub, msg *hub.Message) {
+		received <- msg
+	})
+	defer hub.RemoveTopicListener("data", id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := co.Post(ctx, "/data", coapMessage.AppJSON, bytes.NewReader([]byte(`{"temperature":21.5}`)), tokenQuery(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code() != codes.Changed {
+		t.Fatalf("JSON publish code = %v, want %v", resp.Code(), codes.Changed)
+	}
+	select {
+	case msg := <-received:
+		if msg.Source != client.ID || msg.Payload["temperature"] != 21.5 {
+			t.Errorf("published message = %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("JSON payload was not published")
+	}
+
+	body, _ := cbor.Marshal(map[string]interface{}{"humidity": 40})
+	resp, err = co.Post(ctx, "/data", coapMessage.AppCBOR, bytes.NewReader(body), tokenQuery(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code() != codes.Changed {
+		t.Fatalf("CBOR publish code = %v, want %v", resp.Code(), codes.Changed)
+	}
+	select {
+	case msg := <-received:
+		if _, ok := msg.Payload["humidity"]; !ok {
+			t.Errorf("published message = %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("CBOR payload was not published")
+	}
+
+	resp, err = co.Post(ctx, "/alert", coapMessage.AppJSON, bytes.NewReader([]byte(`{}`)), tokenQuery(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code() != codes.Forbidden {
+		t.Errorf("publish without grant code = %v, want %v", resp.Code(), codes.Forbidden)
+	}
+
+	resp, err = co.Post(ctx, "/data", coapMessage.AppJSON, bytes.NewReader([]byte(`{}`)), tokenQuery("invalid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code() != codes.Unauthorized {
+		t.Errorf("publish with invalid token code = %v, want %v", resp.Code(), codes.Unauthorized)
+	}
+}
+
+func TestCoapObserveCommand(t *testing.T) {
+	h := newTestHub()
+	co := startCoap(t, h)
+	// 默认的传感器权限不包含命令主题的读权限
+	client, token := newTestSensor(t, "data")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	responses := make(chan *pool.Message, 8)
+	obs, err := co.Observe(ctx, "/command", func(m *pool.Message) {
+		m.Hijack()
+		responses <- m
+	}, tokenQuery(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obs.Cancel(context.Background())
+
+	select {
+	case m := <-responses:
+		if m.Code() != codes.Content {
+			t.Fatalf("observe code = %v, want %v", m.Code(), codes.Content)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no observe response")
+	}
+
+	// 观察者在 hub 中注册是异步的，重复发送直到收到通知
+	topic := "command" + hub.TopicSeparator + client.ID + hub.TopicSeparator + "reboot"
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		h.Broadcast(&hub.Message{Topic: "command::other::reboot", Payload: map[string]interface{}{"delay": 0}})
+		h.Broadcast(&hub.Message{Topic: topic, Payload: map[string]interface{}{"delay": 5}})
+		select {
+		case m := <-responses:
+			body, err := io.ReadAll(m.Body())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg hub.Message
+			if err := json.Unmarshal(body, &msg); err != nil {
+				t.Fatalf("invalid notification %q: %v", body, err)
+			}
+			if msg.Topic != topic {
+				t.Fatalf("notification topic = %q, want %q", msg.Topic, topic)
+			}
+			return
+		case <-ticker.C:
+		case <-ctx.Done():
+			t.Fatal("no command notification")
+		}
+	}
+}
@@ -1,17 +1,22 @@
 package servers
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"ultraphx-core/internal/config"
 	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
 	"ultraphx-core/internal/router"
+	"ultraphx-core/pkg/resp"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
-func httpBroadcastHandler(w http.ResponseWriter, r *http.Request, h *hub.Hub) {
+func httpBroadcastHandler(w http.ResponseWriter, r *http.Request, h *hub.Hub, client *models.Client) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -31,15 +36,80 @@ func httpBroadcastHandler(w http.ResponseWriter, r *http.Request, h *hub.Hub) {
 		return
 	}
 
-	h.Broadcast(msg)
+	hubClient := newHubClient(h, client, defaultClientOptions())
+	err = hubClient.Broadcast(msg)
+	switch {
+	case errors.Is(err, hub.ErrPermissionDenied):
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ok"))
 }
 
+// httpRequestHandler 发起请求并同步返回响应
+func httpRequestHandler(c *gin.Context, h *hub.Hub, client *models.Client) {
+	msg := &hub.Message{}
+	if err := c.ShouldBindJSON(msg); err != nil {
+		resp.Error(c, "Failed to parse message")
+		return
+	}
+
+	ms, _ := strconv.Atoi(c.Query("timeout"))
+	ctx, cancel := context.WithTimeout(c.Request.Context(), hub.RequestTimeout(ms))
+	defer cancel()
+
+	hubClient := newHubClient(h, client, defaultClientOptions())
+	reply, err := hubClient.Request(ctx, msg)
+	switch {
+	case errors.Is(err, hub.ErrPermissionDenied):
+		resp.ErrorWithCode(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		resp.ErrorWithCode(c, http.StatusGatewayTimeout, "Request timeout")
+	case err != nil && reply == nil:
+		resp.Error(c, err.Error())
+	case err != nil:
+		resp.ErrorWithCode(c, http.StatusBadGateway, err.Error())
+	default:
+		resp.OK(c, reply)
+	}
+}
+
+// hubStats 返回 hub 的运行状态，本地客户端可以查看全部连接，其他客户端只能查看自己的连接
+func hubStats(h *hub.Hub, client *models.Client) hub.HubStats {
+	stats := h.Stats()
+	if client.Type == models.ClientTypeLocal {
+		return stats
+	}
+	own := make([]hub.ClientStats, 0)
+	for _, s := range stats.Clients {
+		if s.Source == client.ID {
+			own = append(own, s)
+		}
+	}
+	stats.Clients = own
+	return stats
+}
+
 func SetupHttp(h *hub.Hub) {
 	authRouter := router.GetAuthRouter()
 	authRouter.POST("/broadcast", func(c *gin.Context) {
-		httpBroadcastHandler(c.Writer, c.Request, h) // Pass the hub to the httpBroadcastHandler function
+		client := c.MustGet("client").(*models.Client)
+		httpBroadcastHandler(c.Writer, c.Request, h, client) // Pass the hub to the httpBroadcastHandler function
+	})
+	authRouter.POST("/request", func(c *gin.Context) {
+		client := c.MustGet("client").(*models.Client)
+		httpRequestHandler(c, h, client)
+	})
+	authRouter.GET("/sse", func(c *gin.Context) {
+		sseHandler(c, h)
+	})
+	authRouter.GET("/hub/stats", func(c *gin.Context) {
+		client := c.MustGet("client").(*models.Client)
+		resp.OK(c, hubStats(h, client))
 	})
 }
 
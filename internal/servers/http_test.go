@@ -0,0 +1,126 @@
+package servers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+)
+
+func TestHttpBroadcast(t *testing.T) {
+	h := newTestHub()
+	client, _ := newTestSensor(t, "data")
+
+	received := make(chan *hub.Message, 1)
+	id := hub.AddTopicListener("data", func(h *hub.Hub, msg *hub.Message) {
+		received <- msg
+	})
+	defer hub.RemoveTopicListener("data", id)
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"valid", `{"Topic":"data","Payload":{"temperature":21.5}}`, http.StatusOK},
+		{"empty topic", `{"Topic":"","Payload":{}}`, http.StatusBadRequest},
+		{"wildcard topic", `{"Topic":"data::#","Payload":{}}`, http.StatusBadRequest},
+		{"single level wildcard", `{"Topic":"+","Payload":{}}`, http.StatusBadRequest},
+		{"without grant", `{"Topic":"alert","Payload":{}}`, http.StatusForbidden},
+		{"invalid json", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/broadcast", strings.NewReader(tt.body))
+		httpBroadcastHandler(w, r, h, client)
+		if w.Code != tt.code {
+			t.Errorf("%s: code = %d, want %d (%s)", tt.name, w.Code, tt.code, w.Body.String())
+		}
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Source != client.ID || msg.Payload["temperature"] != 21.5 {
+			t.Errorf("published message = %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("valid message was not published")
+	}
+}
+
+func TestHttpBroadcastPendingReply(t *testing.T) {
+	h := newTestHub()
+	// 没有 reply 主题写权限的客户端也可以响应等待中的请求
+	client, _ := newTestSensor(t, "data")
+
+	requests := make(chan *hub.Message, 1)
+	id := hub.AddTopicListener("rpc::http", func(h *hub.Hub, msg *hub.Message) {
+		requests <- msg
+	})
+	defer hub.RemoveTopicListener("rpc::http", id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	replies := make(chan *hub.Message, 1)
+	go func() {
+		reply, err := h.Request(ctx, "rpc::http", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		replies <- reply
+	}()
+
+	var req *hub.Message
+	select {
+	case req = <-requests:
+	case <-ctx.Done():
+		t.Fatal("request was not published")
+	}
+
+	body := `{"Topic":"` + req.ReplyTo + `","CorrelationID":"` + req.CorrelationID + `","Payload":{"ok":true}}`
+	w := httptest.NewRecorder()
+	httpBroadcastHandler(w, httptest.NewRequest(http.MethodPost, "/broadcast", strings.NewReader(body)), h, client)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reply code = %d, want %d (%s)", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	if reply := <-replies; reply == nil || reply.Payload["ok"] != true {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	// 没有等待中的请求时仍然需要写权限
+	w = httptest.NewRecorder()
+	httpBroadcastHandler(w, httptest.NewRequest(http.MethodPost, "/broadcast", strings.NewReader(body)), h, client)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("stale reply code = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestHubStatsOwnClients(t *testing.T) {
+	h := newTestHub()
+	client, _ := newTestSensor(t, "data")
+	other, _ := newTestSensor(t, "data")
+
+	for _, c := range []*models.Client{client, other} {
+		hubClient := newHubClient(h, c, defaultClientOptions())
+		h.Register(hubClient)
+		defer h.Unregister(hubClient)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(h.Stats().Clients) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	stats := hubStats(h, client)
+	if len(stats.Clients) != 1 || stats.Clients[0].Source != client.ID {
+		t.Errorf("sensor sees clients %+v, want only its own", stats.Clients)
+	}
+	local := &models.Client{ID: "local", Type: models.ClientTypeLocal}
+	if stats := hubStats(h, local); len(stats.Clients) != 2 {
+		t.Errorf("local client sees %d clients, want 2", len(stats.Clients))
+	}
+}
@@ -1,47 +1,466 @@
 package servers
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"ultraphx-core/internal/config"
 	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/router"
+	"ultraphx-core/internal/services/ingest"
+	"ultraphx-core/pkg/resp"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
-func MQTTMessageHandler(client mqtt.Client, msg mqtt.Message, h *hub.Hub) {
+// MQTT 桥接
+//
+// 每个桥接连接一个外部 Broker，In 规则订阅外部主题并将消息发布到 hub，
+// Out 规则监听 hub 主题并将消息发布到外部 Broker，消息均以 hub.Message JSON 传输，
+// 配置了接入映射的外部主题则按原始负载转换为 data 消息。
+// 从某个桥接收到的消息会带上 bridge 消息头，不会再被转发回同一个桥接。
+const headerBridge = "bridge"
+
+const (
+	defaultMinReconnectInterval = time.Second
+	defaultMaxReconnectInterval = 2 * time.Minute
+)
+
+var (
+	errInvalidMapping = errors.New("invalid topic mapping")
+	errNoBroker       = errors.New("broker is required")
+)
+
+type BridgeState string
+
+const (
+	BridgeStateConnecting   BridgeState = "connecting"
+	BridgeStateConnected    BridgeState = "connected"
+	BridgeStateDisconnected BridgeState = "disconnected"
+)
+
+type BridgeStatus struct {
+	Name        string      `json:"name"`
+	Broker      string      `json:"broker"`
+	State       BridgeState `json:"state"`
+	ConnectedAt *time.Time  `json:"connectedAt,omitempty"`
+	LastError   string      `json:"lastError,omitempty"`
+	LastErrorAt *time.Time  `json:"lastErrorAt,omitempty"`
+	Reconnects  int         `json:"reconnects"`
+	Received    uint64      `json:"received"` // 从外部 Broker 收到的消息数
+	Sent        uint64      `json:"sent"`     // 发布到外部 Broker 的消息数
+	Dropped     uint64      `json:"dropped"`  // 被丢弃的消息数
+}
+
+// topicMapping 解析后的主题映射，remote 与 local 均按层级拆分
+type topicMapping struct {
+	remote []string
+	local  []string
+}
+
+// wildcards 返回主题中的通配符序列
+func wildcards(levels []string) string {
+	var sb strings.Builder
+	for _, level := range levels {
+		if level == hub.TopicWildcardSL || level == hub.TopicWildcardML {
+			sb.WriteString(level)
+		}
+	}
+	return sb.String()
+}
+
+func parseTopicMapping(m config.MqttTopicMapping) (*topicMapping, error) {
+	if m.Local == "" {
+		m.Local = mqttToHubTopic(m.Remote)
+	}
+	if m.Remote == "" {
+		m.Remote = hubToMqttTopic(m.Local)
+	}
+	if err := hub.ValidateTopicFilter(m.Local); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidMapping, m.Local, err)
+	}
+	if err := hub.ValidateTopicFilter(mqttToHubTopic(m.Remote)); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errInvalidMapping, m.Remote, err)
+	}
+	mapping := &topicMapping{
+		remote: strings.Split(m.Remote, "/"),
+		local:  strings.Split(m.Local, hub.TopicSeparator),
+	}
+	if wildcards(mapping.remote) != wildcards(mapping.local) {
+		return nil, fmt.Errorf("%w: wildcards of %s and %s do not match", errInvalidMapping, m.Remote, m.Local)
+	}
+	return mapping, nil
+}
+
+// mapTopic 将匹配 from 的主题转换为 to 的形式，from 中通配符匹配到的层级按顺序填入 to 的通配符
+func mapTopic(levels, from, to []string) ([]string, bool) {
+	captures := make([][]string, 0)
+	for i, f := range from {
+		if f == hub.TopicWildcardML {
+			captures = append(captures, levels[i:])
+			levels = levels[:i]
+			from = from[:i]
+			break
+		}
+		if i >= len(levels) {
+			return nil, false
+		}
+		if f == hub.TopicWildcardSL {
+			captures = append(captures, levels[i:i+1])
+		} else if f != levels[i] {
+			return nil, false
+		}
+	}
+	if len(from) != len(levels) {
+		return nil, false
+	}
+
+	result := make([]string, 0, len(to))
+	for _, t := range to {
+		if t != hub.TopicWildcardSL && t != hub.TopicWildcardML {
+			result = append(result, t)
+			continue
+		}
+		result = append(result, captures[0]...)
+		captures = captures[1:]
+	}
+	return result, len(result) > 0
+}
+
+type mqttBridge struct {
+	h           *hub.Hub
+	cfg         config.MqttBridgeConfig
+	in          []*topicMapping
+	out         []*topicMapping
+	permissions hub.Permissions
+	client      mqtt.Client
+
+	mu     sync.Mutex
+	status BridgeStatus
+}
+
+var (
+	bridgesMu sync.RWMutex
+	bridges   []*mqttBridge
+)
+
+func newMqttBridge(h *hub.Hub, cfg config.MqttBridgeConfig) (*mqttBridge, error) {
+	if cfg.Broker == "" {
+		return nil, errNoBroker
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Broker
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "ultraphx-bridge-" + cfg.Name
+	}
+	if cfg.MinReconnectInterval <= 0 {
+		cfg.MinReconnectInterval = defaultMinReconnectInterval
+	}
+	if cfg.MaxReconnectInterval < cfg.MinReconnectInterval {
+		cfg.MaxReconnectInterval = max(defaultMaxReconnectInterval, cfg.MinReconnectInterval)
+	}
+	if cfg.QoS > 2 {
+		cfg.QoS = 2
+	}
+
+	b := &mqttBridge{
+		h:           h,
+		cfg:         cfg,
+		permissions: mqttPermissions(),
+		status: BridgeStatus{
+			Name:   cfg.Name,
+			Broker: cfg.Broker,
+			State:  BridgeStateDisconnected,
+		},
+	}
+	for _, m := range cfg.In {
+		mapping, err := parseTopicMapping(m)
+		if err != nil {
+			return nil, err
+		}
+		b.in = append(b.in, mapping)
+	}
+	for _, m := range cfg.Out {
+		mapping, err := parseTopicMapping(m)
+		if err != nil {
+			return nil, err
+		}
+		b.out = append(b.out, mapping)
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.Broker)
+	opts.SetClientID(cfg.ClientID)
+	opts.SetUsername(cfg.Username)
+	opts.SetPassword(cfg.Password)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(cfg.MaxReconnectInterval)
+	opts.SetOnConnectHandler(b.onConnect)
+	opts.SetConnectionLostHandler(b.onConnectionLost)
+	opts.SetReconnectingHandler(b.onReconnecting)
+	tlsConfig, err := bridgeTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	b.client = mqtt.NewClient(opts)
+	return b, nil
+}
+
+// bridgeTLSConfig 根据证书配置创建 TLS 配置，没有配置证书时返回 nil
+func bridgeTLSConfig(cfg config.MqttBridgeConfig) (*tls.Config, error) {
+	if cfg.CACert == "" && cfg.ClientCert == "" && !cfg.InsecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CACert != "" {
+		ca, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (b *mqttBridge) logger() *logrus.Entry {
+	return logrus.WithField("bridge", b.cfg.Name)
+}
+
+func (b *mqttBridge) setError(err error) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.LastError = err.Error()
+	b.status.LastErrorAt = &now
+}
+
+func (b *mqttBridge) setState(state BridgeState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.State = state
+	if state == BridgeStateConnected {
+		now := time.Now()
+		b.status.ConnectedAt = &now
+	}
+}
+
+func (b *mqttBridge) Status() BridgeStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status
+}
+
+// start 监听需要转发的 hub 主题并连接外部 Broker
+func (b *mqttBridge) start() {
+	for _, mapping := range b.out {
+		mapping := mapping
+		hub.AddTopicListener(strings.Join(mapping.local, hub.TopicSeparator), func(h *hub.Hub, msg *hub.Message) {
+			b.forward(mapping, msg)
+		})
+	}
+	go b.connect()
+}
+
+// connect 连接外部 Broker，失败后按退避间隔重试，连接成功后由客户端自动重连
+func (b *mqttBridge) connect() {
+	interval := b.cfg.MinReconnectInterval
+	for {
+		b.setState(BridgeStateConnecting)
+		token := b.client.Connect()
+		token.Wait()
+		if token.Error() == nil {
+			return
+		}
+		b.setState(BridgeStateDisconnected)
+		b.setError(token.Error())
+		b.logger().WithError(token.Error()).Warnf("Failed to connect to MQTT broker, retry in %s", interval)
+		time.Sleep(interval)
+		interval = min(interval*2, b.cfg.MaxReconnectInterval)
+	}
+}
+
+func (b *mqttBridge) onConnect(client mqtt.Client) {
+	b.setState(BridgeStateConnected)
+	b.logger().Info("Connected to MQTT broker")
+	for _, mapping := range b.in {
+		mapping := mapping
+		topic := strings.Join(mapping.remote, "/")
+		token := client.Subscribe(topic, b.cfg.QoS, func(_ mqtt.Client, msg mqtt.Message) {
+			b.receive(mapping, msg)
+		})
+		if token.Wait() && token.Error() != nil {
+			b.setError(token.Error())
+			b.logger().WithError(token.Error()).WithField("topic", topic).Error("Failed to subscribe to topic")
+		}
+	}
+}
+
+func (b *mqttBridge) onConnectionLost(_ mqtt.Client, err error) {
+	b.setState(BridgeStateDisconnected)
+	b.setError(err)
+	b.logger().WithError(err).Warn("Lost connection to MQTT broker")
+}
+
+func (b *mqttBridge) onReconnecting(_ mqtt.Client, _ *mqtt.ClientOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.State = BridgeStateConnecting
+	b.status.Reconnects++
+}
+
+func (b *mqttBridge) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.Dropped++
+}
+
+// receive 将外部 Broker 的消息发布到 hub
+func (b *mqttBridge) receive(mapping *topicMapping, msg mqtt.Message) {
+	levels, ok := mapTopic(strings.Split(msg.Topic(), "/"), mapping.remote, mapping.local)
+	if !ok {
+		b.drop()
+		return
+	}
+	// 配置了接入映射的主题按原始负载转换为 data 消息，桥接由配置文件指定，映射中的客户端视为可信
+	if messages := ingest.Ingest(msg.Topic(), msg.Payload(), "", true); len(messages) > 0 {
+		if !b.permissions.CanWrite(ingest.DataTopic) {
+			b.drop()
+			b.logger().WithField("topic", msg.Topic()).Warn("MQTT ingest denied")
+			return
+		}
+		for _, message := range messages {
+			message.SetHeader(headerBridge, b.cfg.Name)
+			b.publish(message)
+		}
+		return
+	}
+
 	message, err := hub.PraseMessageByte(msg.Payload())
 	if err != nil {
-		logrus.WithError(err).Error("Failed to parse MQTT message")
+		b.drop()
+		b.logger().WithError(err).WithField("topic", msg.Topic()).Warn("Failed to parse MQTT message")
+		return
+	}
+	message.Topic = strings.Join(levels, hub.TopicSeparator)
+	if !b.permissions.CanWrite(message.Topic) {
+		b.drop()
+		b.logger().WithField("topic", message.Topic).Warn("MQTT message denied")
 		return
 	}
-	h.Broadcast(message)
+
+	// 来自 MQTT 的消息没有经过认证的来源
+	message.ResetOrigin("")
+	message.SetHeader(headerBridge, b.cfg.Name)
+	b.publish(message)
 }
 
-func ConnectMQTTBroker(uri string, h *hub.Hub) mqtt.Client {
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(uri)
-	opts.SetClientID("ultraphx-mqtt-client")
-	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
-		MQTTMessageHandler(client, msg, h)
-	})
+func (b *mqttBridge) publish(message *hub.Message) {
+	b.mu.Lock()
+	b.status.Received++
+	b.mu.Unlock()
+	if err := b.h.Publish(message); err != nil {
+		b.logger().WithError(err).WithField("topic", message.Topic).Warn("Failed to publish MQTT message")
+	}
+}
 
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		logrus.WithError(token.Error()).Fatal("Failed to connect to MQTT broker")
+// forward 将 hub 消息发布到外部 Broker
+func (b *mqttBridge) forward(mapping *topicMapping, msg *hub.Message) {
+	if msg.GetHeader(headerBridge) == b.cfg.Name {
+		return
+	}
+	levels, ok := mapTopic(strings.Split(msg.Topic, hub.TopicSeparator), mapping.local, mapping.remote)
+	if !ok {
+		return
+	}
+	if !b.client.IsConnectionOpen() {
+		b.drop()
+		return
 	}
 
-	return client
+	b.mu.Lock()
+	b.status.Sent++
+	b.mu.Unlock()
+	token := b.client.Publish(strings.Join(levels, "/"), b.cfg.QoS, msg.Retain, msg.ToJson())
+	go func() {
+		if token.Wait() && token.Error() != nil {
+			b.setError(token.Error())
+		}
+	}()
 }
 
-func SubscribeToTopic(client mqtt.Client, topic string) {
-	if token := client.Subscribe(topic, 0, nil); token.Wait() && token.Error() != nil {
-		logrus.WithError(token.Error()).Fatal(fmt.Sprintf("Failed to subscribe to topic %s", topic))
+// BridgeStatuses 返回全部桥接的状态
+func BridgeStatuses() []BridgeStatus {
+	bridgesMu.RLock()
+	defer bridgesMu.RUnlock()
+	statuses := make([]BridgeStatus, 0, len(bridges))
+	for _, b := range bridges {
+		statuses = append(statuses, b.Status())
 	}
+	return statuses
 }
 
+// SetupMqtt 根据配置创建 MQTT 桥接
+func SetupMqtt(h *hub.Hub) {
+	bridgesMu.Lock()
+	defer bridgesMu.Unlock()
+	for _, cfg := range config.GetMqttConfig().Bridges {
+		b, err := newMqttBridge(h, cfg)
+		if err != nil {
+			logrus.WithError(err).WithField("bridge", cfg.Name).Error("Invalid MQTT bridge config")
+			continue
+		}
+		bridges = append(bridges, b)
+	}
+
+	authRouter := router.GetAuthRouter()
+	authRouter.GET("/mqtt/bridges", func(c *gin.Context) {
+		resp.OK(c, BridgeStatuses())
+	})
+}
+
+// ServeMQTT 启动 MQTT 桥接与内置 MQTT Broker
 func ServeMQTT(h *hub.Hub) {
-	mqttURI := "tcp://broker.emqx.io:1883" // replace with your MQTT broker URI
-	client := ConnectMQTTBroker(mqttURI, h)
-	SubscribeToTopic(client, "#") // subscribe to all topics
-	logrus.Info("Connected to MQTT broker and subscribed to topic")
+	bridgesMu.RLock()
+	for _, b := range bridges {
+		b.start()
+	}
+	bridgesMu.RUnlock()
+
+	cfg := config.GetMqttConfig()
+	if !cfg.Enabled {
+		return
+	}
+	server, err := newBroker(h, ":"+cfg.Port)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create MQTT broker")
+		return
+	}
+	logrus.Info("Starting MQTT broker on :" + cfg.Port)
+	if err := server.Serve(); err != nil {
+		logrus.WithError(err).Error("Failed to start MQTT broker")
+	}
 }
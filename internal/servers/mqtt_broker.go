@@ -0,0 +1,229 @@
+package servers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/services/ingest"
+
+	mqttServer "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/sirupsen/logrus"
+)
+
+// 内置 MQTT Broker
+//
+// 客户端以 JWT 作为密码连接，每个连接对应一个 hub 客户端，权限与 WebSocket 相同。
+// MQTT 主题中的 / 与 hub 主题中的 :: 互相转换，发布的 JSON 对象作为消息的 Payload，
+// 配置了接入映射的主题则按原始负载转换为 data 消息。订阅到的消息以完整的 hub.Message JSON 下发，
+// 消息全部经由 hub 路由，Broker 自身不转发。
+
+// mqttToHubTopic 将 MQTT 主题转换为 hub 主题，例如 data/s1 -> data::s1
+func mqttToHubTopic(topic string) string {
+	return strings.ReplaceAll(topic, "/", hub.TopicSeparator)
+}
+
+// hubToMqttTopic 将 hub 主题转换为 MQTT 主题，例如 data::s1 -> data/s1
+func hubToMqttTopic(topic string) string {
+	return strings.ReplaceAll(topic, hub.TopicSeparator, "/")
+}
+
+type brokerHook struct {
+	mqttServer.HookBase
+	h *hub.Hub
+
+	mu      sync.RWMutex
+	clients map[*mqttServer.Client]*hub.Client
+	// 本地客户端，接入映射可以将其发布的数据归属于其他客户端
+	locals map[*mqttServer.Client]bool
+}
+
+func newBrokerHook(h *hub.Hub) *brokerHook {
+	return &brokerHook{
+		h:       h,
+		clients: make(map[*mqttServer.Client]*hub.Client),
+		locals:  make(map[*mqttServer.Client]bool),
+	}
+}
+
+func (b *brokerHook) ID() string {
+	return "ultraphx-hub"
+}
+
+func (b *brokerHook) Provides(event byte) bool {
+	return bytes.Contains([]byte{
+		mqttServer.OnConnectAuthenticate,
+		mqttServer.OnACLCheck,
+		mqttServer.OnSessionEstablished,
+		mqttServer.OnDisconnect,
+		mqttServer.OnSubscribed,
+		mqttServer.OnUnsubscribed,
+		mqttServer.OnPublish,
+	}, []byte{event})
+}
+
+func (b *brokerHook) hubClient(cl *mqttServer.Client) *hub.Client {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.clients[cl]
+}
+
+// OnConnectAuthenticate 校验密码中的 JWT 并创建 hub 客户端
+func (b *brokerHook) OnConnectAuthenticate(cl *mqttServer.Client, pk packets.Packet) bool {
+	client, err := authenticateToken(string(pk.Connect.Password))
+	if err != nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clients[cl] = newHubClient(b.h, client, defaultClientOptions())
+	b.locals[cl] = client.Type == models.ClientTypeLocal
+	return true
+}
+
+func (b *brokerHook) OnACLCheck(cl *mqttServer.Client, topic string, write bool) bool {
+	hubClient := b.hubClient(cl)
+	if hubClient == nil {
+		return false
+	}
+	if write {
+		if hubClient.Permissions.CanWrite(mqttToHubTopic(topic)) {
+			return true
+		}
+		// 配置了接入映射的主题转换为 data 消息发布，只需要 data 主题的写权限
+		return ingest.Matches(topic) && hubClient.Permissions.CanWrite(ingest.DataTopic)
+	}
+	// 订阅时只校验格式，实际下发的消息由 hub 按读权限过滤
+	return hub.ValidateTopicFilter(mqttToHubTopic(topic)) == nil
+}
+
+func (b *brokerHook) OnSessionEstablished(cl *mqttServer.Client, pk packets.Packet) {
+	hubClient := b.hubClient(cl)
+	if hubClient == nil {
+		return
+	}
+	b.h.Register(hubClient)
+	go b.writePump(cl, hubClient)
+	logrus.WithField("client_id", hubClient.Source).WithField("mqtt_id", cl.ID).Info("MQTT client connected")
+}
+
+// writePump 将 hub 消息转发给 MQTT 客户端
+func (b *brokerHook) writePump(cl *mqttServer.Client, hubClient *hub.Client) {
+	for msg := range hubClient.SendChan {
+		pk := packets.Packet{
+			FixedHeader: packets.FixedHeader{
+				Type: packets.Publish,
+			},
+			TopicName: hubToMqttTopic(msg.Topic),
+			Payload:   msg.ToJson(),
+		}
+		if err := cl.WritePacket(pk); err != nil {
+			logrus.WithError(err).WithField("mqtt_id", cl.ID).Debug("Failed to write MQTT packet")
+		}
+	}
+}
+
+func (b *brokerHook) OnDisconnect(cl *mqttServer.Client, err error, expire bool) {
+	b.mu.Lock()
+	hubClient, ok := b.clients[cl]
+	delete(b.clients, cl)
+	delete(b.locals, cl)
+	b.mu.Unlock()
+	if ok {
+		b.h.Unregister(hubClient)
+	}
+}
+
+func (b *brokerHook) OnSubscribed(cl *mqttServer.Client, pk packets.Packet, reasonCodes []byte) {
+	hubClient := b.hubClient(cl)
+	if hubClient == nil {
+		return
+	}
+	for i, filter := range pk.Filters {
+		if i < len(reasonCodes) && reasonCodes[i] >= packets.ErrUnspecifiedError.Code {
+			continue
+		}
+		if err := hubClient.Subscribe(mqttToHubTopic(filter.Filter)); err != nil {
+			logrus.WithError(err).WithField("filter", filter.Filter).Warn("Failed to subscribe")
+		}
+	}
+}
+
+func (b *brokerHook) OnUnsubscribed(cl *mqttServer.Client, pk packets.Packet) {
+	hubClient := b.hubClient(cl)
+	if hubClient == nil {
+		return
+	}
+	for _, filter := range pk.Filters {
+		hubClient.Unsubscribe(mqttToHubTopic(filter.Filter))
+	}
+}
+
+// OnPublish 将消息发布到 hub，并阻止 Broker 自行转发
+func (b *brokerHook) OnPublish(cl *mqttServer.Client, pk packets.Packet) (packets.Packet, error) {
+	hubClient := b.hubClient(cl)
+	if hubClient == nil {
+		return pk, packets.ErrRejectPacket
+	}
+
+	// 配置了接入映射的主题按原始负载转换为 data 消息，数据默认归属于发布者
+	b.mu.RLock()
+	local := b.locals[cl]
+	b.mu.RUnlock()
+	if messages := ingest.Ingest(pk.TopicName, pk.Payload, hubClient.Source, local); len(messages) > 0 {
+		if !hubClient.Permissions.CanWrite(ingest.DataTopic) {
+			logrus.WithField("client_id", hubClient.Source).WithField("topic", pk.TopicName).Warn("MQTT ingest denied")
+			return pk, packets.CodeSuccessIgnore
+		}
+		for _, msg := range messages {
+			if err := b.h.Publish(msg); err != nil {
+				logrus.WithError(err).WithField("topic", pk.TopicName).Warn("Failed to publish ingested MQTT message")
+			}
+		}
+		return pk, packets.CodeSuccessIgnore
+	}
+
+	payload := make(map[string]interface{})
+	if len(pk.Payload) > 0 {
+		if err := json.Unmarshal(pk.Payload, &payload); err != nil {
+			logrus.WithError(err).WithField("topic", pk.TopicName).Warn("Invalid MQTT payload")
+			return pk, packets.CodeSuccessIgnore
+		}
+	}
+	msg := &hub.Message{
+		Topic:   mqttToHubTopic(pk.TopicName),
+		Retain:  pk.FixedHeader.Retain,
+		Payload: payload,
+	}
+	if err := hubClient.Broadcast(msg); err != nil {
+		logrus.WithError(err).WithField("topic", msg.Topic).Warn("Failed to broadcast MQTT message")
+	}
+	return pk, packets.CodeSuccessIgnore
+}
+
+// newBroker 创建监听 addr 的 MQTT Broker
+func newBroker(h *hub.Hub, addr string) (*mqttServer.Server, error) {
+	server := mqttServer.New(&mqttServer.Options{
+		Logger: slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: slog.LevelWarn,
+		})),
+	})
+	if err := server.AddHook(newBrokerHook(h), nil); err != nil {
+		return nil, err
+	}
+	tcp := listeners.NewTCP(listeners.Config{
+		ID:      "tcp",
+		Address: addr,
+	})
+	if err := server.AddListener(tcp); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
@@ -0,0 +1,131 @@
+package servers
+
+import (
+	"testing"
+	"time"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/services/ingest"
+	"ultraphx-core/pkg/global"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+// startBroker 在回环地址上启动内置 MQTT Broker 并返回其地址
+func startBroker(t *testing.T, h *hub.Hub) string {
+	t.Helper()
+	server, err := newBroker(h, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	l, ok := server.Listeners.Get("tcp")
+	if !ok {
+		t.Fatal("tcp listener not found")
+	}
+	return "tcp://" + l.Address()
+}
+
+func connectMqtt(t *testing.T, addr, token string) mqtt.Client {
+	t.Helper()
+	opts := mqtt.NewClientOptions().
+		AddBroker(addr).
+		SetClientID(uuid.New().String()).
+		SetUsername("sensor").
+		SetPassword(token).
+		SetAutoReconnect(false)
+	client := mqtt.NewClient(opts)
+	if token := client.Connect(); !token.WaitTimeout(2*time.Second) || token.Error() != nil {
+		t.Fatalf("failed to connect to broker: %v", token.Error())
+	}
+	t.Cleanup(func() { client.Disconnect(0) })
+	return client
+}
+
+// addIngestMapping 保存接入映射并重新加载
+func addIngestMapping(t *testing.T, mapping ingest.IngestMapping) {
+	t.Helper()
+	models.AutoMigrate(&ingest.IngestMapping{})
+	mapping.ID = uuid.New().String()
+	if err := mapping.Query().Create(&mapping).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ingest.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		mapping.Query().Where("id = ?", mapping.ID).Delete(&ingest.IngestMapping{})
+		ingest.Reload()
+	})
+}
+
+func TestBrokerIngestVendorTopic(t *testing.T) {
+	h := newTestHub()
+	addr := startBroker(t, h)
+	addIngestMapping(t, ingest.IngestMapping{
+		Name:  "tasmota",
+		Topic: "tele/+/SENSOR",
+		Fields: []ingest.IngestField{
+			{Path: "ENERGY.Power", Metric: "power"},
+		},
+	})
+
+	received := make(chan *hub.Message, 4)
+	id := hub.AddTopicListener(ingest.DataTopic, func(h *hub.Hub, msg *hub.Message) {
+		received <- msg
+	})
+	defer hub.RemoveTopicListener(ingest.DataTopic, id)
+
+	// 传感器只有 data 主题的写权限，没有 tele/# 的写权限
+	sensor, token := newTestSensor(t, ingest.DataTopic)
+	client := connectMqtt(t, addr, token)
+
+	payload := `{"Time":"2024-06-01T00:00:00","ENERGY":{"Power":12.5}}`
+	for _, qos := range []byte{0, 1} {
+		if token := client.Publish("tele/plug/SENSOR", qos, false, payload); !token.WaitTimeout(2*time.Second) || token.Error() != nil {
+			t.Fatalf("QoS %d publish failed: %v", qos, token.Error())
+		}
+		select {
+		case msg := <-received:
+			data, ok := msg.Payload["data"].(global.SensorData)
+			if msg.Source != sensor.ID || !ok || data["power"] != 12.5 {
+				t.Errorf("QoS %d data message = %+v", qos, msg)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("QoS %d publish produced no data message", qos)
+		}
+	}
+	if !client.IsConnectionOpen() {
+		t.Error("client was disconnected")
+	}
+}
+
+func TestBrokerIngestRequiresDataWrite(t *testing.T) {
+	h := newTestHub()
+	addr := startBroker(t, h)
+	addIngestMapping(t, ingest.IngestMapping{
+		Name:  "tasmota",
+		Topic: "tele/+/SENSOR",
+	})
+
+	received := make(chan *hub.Message, 4)
+	id := hub.AddTopicListener(ingest.DataTopic, func(h *hub.Hub, msg *hub.Message) {
+		received <- msg
+	})
+	defer hub.RemoveTopicListener(ingest.DataTopic, id)
+
+	_, token := newTestSensor(t, "alert")
+	client := connectMqtt(t, addr, token)
+	client.Publish("tele/plug/SENSOR", 0, false, `{"Power":12.5}`).WaitTimeout(2 * time.Second)
+	// 没有映射的主题仍然需要该主题的写权限
+	client.Publish("tele/plug/STATE", 0, false, `{"Power":12.5}`).WaitTimeout(2 * time.Second)
+
+	select {
+	case msg := <-received:
+		t.Errorf("client without data write published %+v", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
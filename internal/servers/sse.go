@@ -0,0 +1,175 @@
+package servers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/services/journal"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Server-Sent Events
+//
+//	GET /api/auth/sse?topic=data::#&topic=alert::#&token=...
+//
+// 每条消息以 message 事件推送，data 为 hub.Message JSON。记录在消息日志中的消息以偏移量作为事件 ID，
+// 断线重连时浏览器会带上 Last-Event-ID（也可以使用 lastEventId 参数），服务端先重放其后的历史消息再推送实时消息。
+// 没有消息时按 heartbeat 参数（单位为秒）发送注释行保持连接。
+const defaultSseHeartbeat = 15 * time.Second
+
+// sseStream 一个 SSE 连接
+type sseStream struct {
+	hubClient *hub.Client
+	c         *gin.Context
+	topics    []string
+	// 重放过的偏移量范围 [replayFrom, replayUntil)，订阅生效前记录但稍后才投递的消息会同时出现在重放与实时消息中，
+	// 实时消息只需去掉落在该范围内的消息，范围之外的消息不论偏移量顺序都照常推送
+	replayFrom  uint64
+	replayUntil uint64
+}
+
+func (s *sseStream) matches(topic string) bool {
+	for _, filter := range s.topics {
+		if hub.MatchTopic(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendLive 推送实时消息，跳过已经重放过的消息
+func (s *sseStream) sendLive(msg *hub.Message) error {
+	if msg.Offset >= s.replayFrom && msg.Offset < s.replayUntil {
+		return nil
+	}
+	return s.send(msg)
+}
+
+func (s *sseStream) send(msg *hub.Message) error {
+	if msg.Offset > 0 {
+		if _, err := fmt.Fprintf(s.c.Writer, "id: %d\n", msg.Offset); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.c.Writer, "event: message\ndata: %s\n\n", msg.ToJson()); err != nil {
+		return err
+	}
+	s.c.Writer.Flush()
+	return nil
+}
+
+// subscribe 订阅全部主题，from 不为 0 且启用了消息日志时先重放 from 之后的历史消息
+func (s *sseStream) subscribe(from uint64) error {
+	j := journal.Get()
+	if from == 0 || j == nil {
+		for _, topic := range s.topics {
+			if err := s.hubClient.Subscribe(topic); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	next := from
+	send := func(msg *hub.Message) error {
+		if !s.matches(msg.Topic) || !s.hubClient.Permissions.CanRead(msg.Topic) {
+			return nil
+		}
+		next = msg.Offset + 1
+		return s.send(msg)
+	}
+	if err := j.Replay(hub.TopicWildcardML, from, time.Time{}, 0, send); err != nil {
+		return err
+	}
+	for _, topic := range s.topics {
+		if err := s.hubClient.Subscribe(topic); err != nil {
+			return err
+		}
+	}
+	// 补发重放结束到订阅生效之间记录的消息，此后记录的消息都会作为实时消息送达
+	until := j.NextOffset()
+	s.replayFrom, s.replayUntil = from, until
+	return j.Replay(hub.TopicWildcardML, next, time.Time{}, until, send)
+}
+
+func sseHandler(c *gin.Context, h *hub.Hub) {
+	client := c.MustGet("client").(*models.Client)
+	topics := c.QueryArray("topic")
+	if len(topics) == 0 {
+		c.String(http.StatusBadRequest, "topic is required")
+		return
+	}
+	for _, topic := range topics {
+		if err := hub.ValidateTopicFilter(topic); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	from := uint64(0)
+	if offset, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		from = offset + 1
+	}
+	heartbeat := defaultSseHeartbeat
+	if seconds, err := strconv.Atoi(c.Query("heartbeat")); err == nil && seconds > 0 {
+		heartbeat = time.Duration(seconds) * time.Second
+	}
+
+	opts, err := queryClientOptions(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hubClient := newHubClient(h, client, opts)
+	h.Register(hubClient)
+	defer h.Unregister(hubClient)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	stream := &sseStream{
+		hubClient: hubClient,
+		c:         c,
+		topics:    topics,
+	}
+	if err := stream.subscribe(from); err != nil {
+		fmt.Fprintf(c.Writer, "event: error\ndata: %s\n\n", err.Error())
+		return
+	}
+	logrus.WithField("client_id", client.ID).WithField("topics", topics).Info("SSE client connected")
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case msg, ok := <-hubClient.SendChan:
+			if !ok {
+				return
+			}
+			if err := stream.sendLive(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -1,89 +1,214 @@
 package servers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
+	"ultraphx-core/internal/config"
 	"ultraphx-core/internal/hub"
 	"ultraphx-core/internal/models"
 	"ultraphx-core/internal/router"
+	"ultraphx-core/internal/services/journal"
+	"ultraphx-core/pkg/resp"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
+// 每个连接同时等待响应的 request 上限
+const maxWsRequests = 32
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
-func readPump(hubClient *hub.Client, conn *websocket.Conn, client *models.Client) {
+// wsSession 一个 WebSocket 连接，读写分别由 readPump 和 writePump 负责
+type wsSession struct {
+	hubClient *hub.Client
+	client    *models.Client
+	conn      *websocket.Conn
+	replies   chan *WsFrame
+	requests  chan struct{} // 限制同时等待响应的 request 数量
+	done      chan struct{}
+}
+
+func newWsSession(h *hub.Hub, client *models.Client, conn *websocket.Conn, opts hub.ClientOptions) *wsSession {
+	return &wsSession{
+		hubClient: newHubClient(h, client, opts),
+		client:    client,
+		conn:      conn,
+		replies:   make(chan *WsFrame, 16),
+		requests:  make(chan struct{}, maxWsRequests),
+		done:      make(chan struct{}),
+	}
+}
+
+func (s *wsSession) start() {
+	s.hubClient.Hub.Register(s.hubClient)
+	go s.readPump()
+	go s.writePump()
+}
+
+func (s *wsSession) reply(frame *WsFrame) {
+	select {
+	case s.replies <- frame:
+	case <-s.done:
+	}
+}
+
+func (s *wsSession) readPump() {
 	defer func() {
-		hubClient.Hub.Unregister(hubClient)
-		conn.Close()
+		s.hubClient.Hub.Unregister(s.hubClient)
+		s.conn.Close()
 	}()
 
 	for {
-		_, payload, err := conn.ReadMessage()
+		_, payload, err := s.conn.ReadMessage()
 		if err != nil {
 			logrus.WithError(err).Error("Failed to read message from websocket")
 			break
 		}
-		msg, err := hub.PraseMessageByte(payload)
-		if err != nil {
-			logrus.WithError(err).Error("Failed to parse message")
+		frame := &WsFrame{}
+		if err := json.Unmarshal(payload, frame); err != nil {
+			logrus.WithError(err).Error("Failed to parse frame")
+			s.reply(errorFrame("", err))
+			continue
+		}
+		if frame.isReplay() {
+			go func() {
+				s.reply(s.replaySubscribe(frame))
+			}()
+			continue
+		}
+		if frame.Op == WsOpRequest {
+			// 请求需要等待响应，不能阻塞读取
+			select {
+			case s.requests <- struct{}{}:
+				go func() {
+					defer func() { <-s.requests }()
+					s.reply(handleRequest(s.hubClient, frame))
+				}()
+			default:
+				s.reply(errorFrame(frame.ID, errTooManyRequests))
+			}
+			continue
 		}
-		// handel message
-		msg.Payload["senderID"] = client.ID
+		s.reply(handleFrame(s.hubClient, frame))
+	}
+}
+
+// replaySubscribe 重放消息日志中的历史消息后订阅实时消息
+func (s *wsSession) replaySubscribe(frame *WsFrame) *WsFrame {
+	j := journal.Get()
+	if j == nil {
+		return errorFrame(frame.ID, errJournalDisabled)
+	}
+	if err := hub.ValidateTopicFilter(frame.Topic); err != nil {
+		return errorFrame(frame.ID, err)
+	}
 
-		hubClient.Broadcast(msg)
+	since := time.Time{}
+	if frame.Since != nil {
+		since = *frame.Since
 	}
+	next := frame.FromOffset
+	send := func(msg *hub.Message) error {
+		if !s.hubClient.Permissions.CanRead(msg.Topic) {
+			return nil
+		}
+		select {
+		case s.replies <- messageFrame(msg):
+		case <-s.done:
+			return errSessionClosed
+		}
+		next = msg.Offset + 1
+		return nil
+	}
+
+	if err := j.Replay(frame.Topic, next, since, 0, send); err != nil {
+		return errorFrame(frame.ID, err)
+	}
+	if err := s.hubClient.Subscribe(frame.Topic); err != nil {
+		return errorFrame(frame.ID, err)
+	}
+	// 补发重放结束到订阅生效之间记录的消息
+	if err := j.Replay(frame.Topic, next, since, j.NextOffset(), send); err != nil {
+		return errorFrame(frame.ID, err)
+	}
+	return ackFrame(frame.ID)
 }
 
-func writePump(client *hub.Client, conn *websocket.Conn) {
+func (s *wsSession) writePump() {
 	ticker := time.NewTicker(10 * time.Second)
 	defer func() {
 		ticker.Stop()
-		conn.Close()
+		close(s.done)
+		s.conn.Close()
 	}()
 
 	for {
 		select {
-		case message, ok := <-client.SendChan:
+		case message, ok := <-s.hubClient.SendChan:
 			if !ok {
-				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				s.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			if err := conn.WriteMessage(websocket.TextMessage, message.ToJson()); err != nil {
+			if err := s.conn.WriteMessage(websocket.TextMessage, messageFrame(message).ToJson()); err != nil {
+				logrus.WithError(err).Error("Failed to write message to websocket")
+				return
+			}
+		case frame := <-s.replies:
+			if err := s.conn.WriteMessage(websocket.TextMessage, frame.ToJson()); err != nil {
 				logrus.WithError(err).Error("Failed to write message to websocket")
 				return
 			}
 		case <-ticker.C:
-			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
 	}
 }
 
+// queryClientOptions 允许连接时通过 queueSize 与 overflow 参数覆盖默认的队列设置，queueSize 不能超过 hub.maxQueueSize
+func queryClientOptions(c *gin.Context) (hub.ClientOptions, error) {
+	opts := defaultClientOptions()
+	if size, err := strconv.Atoi(c.Query("queueSize")); err == nil && size > 0 {
+		if maxSize := config.GetHubConfig().MaxQueueSize; size > maxSize {
+			return opts, fmt.Errorf("queueSize must not exceed %d", maxSize)
+		}
+		opts.QueueSize = size
+	}
+	if policy := hub.OverflowPolicy(c.Query("overflow")); policy.IsValid() {
+		opts.OverflowPolicy = policy
+	}
+	return opts, nil
+}
+
 func wsHandler(c *gin.Context, h *hub.Hub) {
 	client := c.MustGet("client").(*models.Client)
+	opts, err := queryClientOptions(c)
+	if err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to upgrade connection to websocket")
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	hubClient := hub.NewClient(uuid.New().String(), h)
-	h.Register(hubClient)
-	logrus.WithField("client_id", hubClient.ID).Info("Client connected")
-	go readPump(hubClient, conn, client)
-	go writePump(hubClient, conn)
+	session := newWsSession(h, client, conn, opts)
+	session.start()
+	logrus.WithField("client_id", session.hubClient.ID).Info("Client connected")
 }
 
 func SetupWs(h *hub.Hub) {
@@ -106,6 +231,8 @@ func SetupWs(h *hub.Hub) {
 		}
 		ConnectWs(u, h, client)
 	})
+	// 持久化并自动重连的反向ws
+	setupLinks(h)
 }
 
 func ConnectWs(u *url.URL, h *hub.Hub, client *models.Client) {
@@ -114,8 +241,5 @@ func ConnectWs(u *url.URL, h *hub.Hub, client *models.Client) {
 		logrus.WithError(err).Error("Failed to connect to websocket")
 		return
 	}
-	hubClient := hub.NewClient(uuid.New().String(), h)
-	h.Register(hubClient)
-	go readPump(hubClient, conn, client)
-	go writePump(hubClient, conn)
+	newWsSession(h, client, conn, defaultClientOptions()).start()
 }
@@ -0,0 +1,375 @@
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 反向 WebSocket 连接
+//
+// 网关主动连接远端（例如中心服务器的 /api/auth/ws），作为 WebSocket 控制协议的客户端：
+// 连接后向远端订阅 InTopics，收到的消息以 Owner 客户端的身份发布到本地 hub；
+// 本地与 OutTopics 匹配的消息以 publish 帧发送给远端。连接断开后按指数退避重连。
+// 从连接收到的消息会带上 link 消息头，不会再被转发回远端；发送到远端的消息同样带上 link 消息头，
+// 远端回显时按消息头丢弃。远端会重新生成消息 ID，因此不能按 ID 识别回显。
+const headerLink = "link"
+
+const (
+	minLinkReconnectInterval = time.Second
+	maxLinkReconnectInterval = time.Minute
+	linkPingInterval         = 10 * time.Second
+	linkHandshakeTimeout     = 10 * time.Second
+)
+
+var errLinkStopped = errors.New("link stopped")
+
+type WsLink struct {
+	models.Model
+	Name    string            `json:"name"`
+	URL     string            `json:"url" binding:"required"`
+	Headers map[string]string `json:"headers" gorm:"serializer:json"`
+	// 以 Bearer 形式放入 Authorization 请求头
+	Token string `json:"token"`
+	// 本地消息所属的客户端，收发消息使用该客户端的权限
+	ClientID string `json:"clientId"`
+	// 从远端订阅并发布到本地 hub 的主题
+	InTopics []string `json:"inTopics" gorm:"serializer:json"`
+	// 从本地 hub 发送到远端的主题
+	OutTopics []string `json:"outTopics" gorm:"serializer:json"`
+	Enabled   bool     `json:"enabled"`
+}
+
+func (l *WsLink) Query() *gorm.DB {
+	return models.DB.Model(l)
+}
+
+type WsLinkState string
+
+const (
+	WsLinkStateConnecting   WsLinkState = "connecting"
+	WsLinkStateConnected    WsLinkState = "connected"
+	WsLinkStateDisconnected WsLinkState = "disconnected"
+	WsLinkStateDisabled     WsLinkState = "disabled"
+)
+
+type WsLinkStatus struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	State       WsLinkState `json:"state"`
+	ConnectedAt *time.Time  `json:"connectedAt,omitempty"`
+	LastError   string      `json:"lastError,omitempty"`
+	LastErrorAt *time.Time  `json:"lastErrorAt,omitempty"`
+	Reconnects  int         `json:"reconnects"`
+	Received    uint64      `json:"received"` // 从远端收到的消息数
+	Sent        uint64      `json:"sent"`     // 发送到远端的消息数
+}
+
+// wsLinkRunner 维护一个反向连接
+type wsLinkRunner struct {
+	h      *hub.Hub
+	link   WsLink
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	status WsLinkStatus
+}
+
+var (
+	linksMu sync.Mutex
+	links   = make(map[string]*wsLinkRunner)
+)
+
+func newWsLinkRunner(h *hub.Hub, link WsLink) *wsLinkRunner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &wsLinkRunner{
+		h:      h,
+		link:   link,
+		ctx:    ctx,
+		cancel: cancel,
+		status: WsLinkStatus{
+			ID:    link.ID,
+			Name:  link.Name,
+			State: WsLinkStateDisconnected,
+		},
+	}
+}
+
+func (r *wsLinkRunner) logger() *logrus.Entry {
+	return logrus.WithField("link", r.link.Name).WithField("url", r.link.URL)
+}
+
+func (r *wsLinkRunner) Status() WsLinkStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+func (r *wsLinkRunner) setState(state WsLinkState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.State = state
+	if state == WsLinkStateConnected {
+		now := time.Now()
+		r.status.ConnectedAt = &now
+	}
+}
+
+func (r *wsLinkRunner) setError(err error) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastError = err.Error()
+	r.status.LastErrorAt = &now
+}
+
+func (r *wsLinkRunner) markSent() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Sent++
+}
+
+// outgoing 复制发送到远端的消息并带上 link 消息头，消息会同时投递给其他客户端，不能直接修改
+func (r *wsLinkRunner) outgoing(msg *hub.Message) *hub.Message {
+	out := *msg
+	out.Headers = make(map[string]string, len(msg.Headers)+1)
+	for key, value := range msg.Headers {
+		out.Headers[key] = value
+	}
+	out.Headers[headerLink] = r.link.ID
+	return &out
+}
+
+func (r *wsLinkRunner) start() {
+	go r.run()
+}
+
+func (r *wsLinkRunner) stop() {
+	r.cancel()
+}
+
+// run 保持连接，断开后按指数退避重连，连接保持超过最大间隔后重置退避
+func (r *wsLinkRunner) run() {
+	interval := minLinkReconnectInterval
+	for {
+		connectedAt := time.Now()
+		err := r.connect()
+		if r.ctx.Err() != nil {
+			r.setState(WsLinkStateDisabled)
+			return
+		}
+		r.setState(WsLinkStateDisconnected)
+		if err != nil {
+			r.setError(err)
+			r.logger().WithError(err).Warnf("Reverse websocket disconnected, retry in %s", interval)
+		}
+		if time.Since(connectedAt) > maxLinkReconnectInterval {
+			interval = minLinkReconnectInterval
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-r.ctx.Done():
+			r.setState(WsLinkStateDisabled)
+			return
+		}
+		interval = min(interval*2, maxLinkReconnectInterval)
+		r.mu.Lock()
+		r.status.Reconnects++
+		r.mu.Unlock()
+	}
+}
+
+// connect 建立一次连接并阻塞到连接断开
+func (r *wsLinkRunner) connect() error {
+	r.setState(WsLinkStateConnecting)
+
+	client := models.Client{
+		ID: r.link.ClientID,
+	}
+	if err := client.Query().Preload("Permissions").First(&client).Error; err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	for key, value := range r.link.Headers {
+		header.Set(key, value)
+	}
+	if r.link.Token != "" {
+		header.Set("Authorization", "Bearer "+r.link.Token)
+	}
+	dialer := websocket.Dialer{
+		HandshakeTimeout: linkHandshakeTimeout,
+	}
+	conn, _, err := dialer.DialContext(r.ctx, r.link.URL, header)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	hubClient := newHubClient(r.h, &client, defaultClientOptions())
+	r.h.Register(hubClient)
+	defer r.h.Unregister(hubClient)
+
+	for _, topic := range r.link.OutTopics {
+		if err := hubClient.Subscribe(topic); err != nil {
+			return err
+		}
+	}
+	for i, topic := range r.link.InTopics {
+		frame := &WsFrame{Op: WsOpSubscribe, ID: "subscribe-" + strconv.Itoa(i), Topic: topic}
+		if err := conn.WriteMessage(websocket.TextMessage, frame.ToJson()); err != nil {
+			return err
+		}
+	}
+	r.setState(WsLinkStateConnected)
+	r.logger().Info("Reverse websocket connected")
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- r.readPump(conn, hubClient)
+	}()
+	return r.writePump(conn, hubClient, readErr)
+}
+
+// readPump 处理远端发来的帧
+func (r *wsLinkRunner) readPump(conn *websocket.Conn, hubClient *hub.Client) error {
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		frame := &WsFrame{}
+		if err := json.Unmarshal(payload, frame); err != nil {
+			continue
+		}
+		switch frame.Op {
+		case WsOpMessage:
+			r.receive(hubClient, frame.Message)
+		case WsOpError:
+			r.setError(errors.New(frame.Error))
+			r.logger().WithField("id", frame.ID).Warn("Remote error: ", frame.Error)
+		}
+	}
+}
+
+// receive 以连接所属客户端的身份发布远端消息
+func (r *wsLinkRunner) receive(hubClient *hub.Client, msg *hub.Message) {
+	// 本连接发送到远端的消息被回显
+	if msg == nil || msg.GetHeader(headerLink) == r.link.ID {
+		return
+	}
+	matched := false
+	for _, filter := range r.link.InTopics {
+		if hub.MatchTopic(filter, msg.Topic) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return
+	}
+
+	msg.SetHeader(headerLink, r.link.ID)
+	r.mu.Lock()
+	r.status.Received++
+	r.mu.Unlock()
+	if err := hubClient.Broadcast(msg); err != nil {
+		r.logger().WithError(err).WithField("topic", msg.Topic).Warn("Failed to publish remote message")
+	}
+}
+
+// writePump 将本地消息发送给远端，并定时发送 ping
+func (r *wsLinkRunner) writePump(conn *websocket.Conn, hubClient *hub.Client, readErr <-chan error) error {
+	ticker := time.NewTicker(linkPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-hubClient.SendChan:
+			if !ok {
+				return hub.ErrClientClosed
+			}
+			if msg.GetHeader(headerLink) == r.link.ID {
+				continue
+			}
+			frame := &WsFrame{Op: WsOpPublish, Message: r.outgoing(msg)}
+			if err := conn.WriteMessage(websocket.TextMessage, frame.ToJson()); err != nil {
+				return err
+			}
+			r.markSent()
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(linkPingInterval))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return err
+			}
+		case err := <-readErr:
+			return err
+		case <-r.ctx.Done():
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return errLinkStopped
+		}
+	}
+}
+
+// startLink 启动或重启连接，未启用的连接只会被停止
+func startLink(h *hub.Hub, link WsLink) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	if runner, ok := links[link.ID]; ok {
+		runner.stop()
+	}
+	runner := newWsLinkRunner(h, link)
+	links[link.ID] = runner
+	if !link.Enabled {
+		runner.status.State = WsLinkStateDisabled
+		return
+	}
+	runner.start()
+}
+
+func stopLink(id string) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	if runner, ok := links[id]; ok {
+		runner.stop()
+		delete(links, id)
+	}
+}
+
+// LinkStatuses 返回属于 clientID 的反向连接的状态，clientID 为空时返回全部连接
+func LinkStatuses(clientID string) []WsLinkStatus {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	statuses := make([]WsLinkStatus, 0, len(links))
+	for _, runner := range links {
+		if clientID != "" && runner.link.ClientID != clientID {
+			continue
+		}
+		statuses = append(statuses, runner.Status())
+	}
+	return statuses
+}
+
+// loadLinks 启动数据库中保存的全部反向连接
+func loadLinks(h *hub.Hub) {
+	var records []WsLink
+	if err := (&WsLink{}).Query().Find(&records).Error; err != nil {
+		logrus.WithError(err).Error("Failed to load reverse websocket links")
+		return
+	}
+	for _, link := range records {
+		startLink(h, link)
+	}
+}
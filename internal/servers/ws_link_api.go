@@ -0,0 +1,202 @@
+package servers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/router"
+	"ultraphx-core/pkg/resp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 返回连接时以该值代替 Token 与请求头的值，更新时提交该值表示保留原值
+const linkSecretMask = "******"
+
+var errInvalidLinkURL = errors.New("url must be a ws:// or wss:// address")
+
+func checkLink(c *gin.Context, link *WsLink) error {
+	u, err := url.Parse(link.URL)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") {
+		return errInvalidLinkURL
+	}
+	for _, topic := range append(append([]string{}, link.InTopics...), link.OutTopics...) {
+		if err := hub.ValidateTopicFilter(topic); err != nil {
+			return err
+		}
+	}
+
+	// 只有本地客户端可以为其他客户端创建连接
+	client := c.MustGet("client").(*models.Client)
+	if link.ClientID == "" || client.Type != models.ClientTypeLocal {
+		link.ClientID = client.ID
+	}
+	return nil
+}
+
+// redacted 返回隐藏了 Token 与请求头的值的副本，这些值是远端的凭据
+func (l WsLink) redacted() WsLink {
+	if l.Token != "" {
+		l.Token = linkSecretMask
+	}
+	headers := make(map[string]string, len(l.Headers))
+	for key := range l.Headers {
+		headers[key] = linkSecretMask
+	}
+	l.Headers = headers
+	return l
+}
+
+// keepSecrets 将提交的掩码还原为已保存的 Token 与请求头的值
+func (l *WsLink) keepSecrets(stored *WsLink) {
+	if l.Token == linkSecretMask {
+		l.Token = stored.Token
+	}
+	for key, value := range l.Headers {
+		if value == linkSecretMask {
+			l.Headers[key] = stored.Headers[key]
+		}
+	}
+}
+
+// linkOwner 返回可以查看的连接所属的客户端，本地客户端可以查看全部连接，返回空
+func linkOwner(c *gin.Context) string {
+	client := c.MustGet("client").(*models.Client)
+	if client.Type == models.ClientTypeLocal {
+		return ""
+	}
+	return client.ID
+}
+
+// ownedLink 读取当前客户端可以管理的连接
+func ownedLink(c *gin.Context, id string) (*WsLink, error) {
+	link := WsLink{}
+	if err := link.Query().Where("id = ?", id).First(&link).Error; err != nil {
+		return nil, err
+	}
+	if owner := linkOwner(c); owner != "" && link.ClientID != owner {
+		return nil, hub.ErrPermissionDenied
+	}
+	return &link, nil
+}
+
+func linkError(c *gin.Context, err error) {
+	if errors.Is(err, hub.ErrPermissionDenied) {
+		resp.ErrorWithCode(c, http.StatusForbidden, err.Error())
+		return
+	}
+	resp.Error(c, err.Error())
+}
+
+func GetLinks(c *gin.Context) {
+	var records []WsLink
+	query := (&WsLink{}).Query()
+	if owner := linkOwner(c); owner != "" {
+		query = query.Where("client_id = ?", owner)
+	}
+	if err := query.Find(&records).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+
+	links := make([]WsLink, 0, len(records))
+	for _, link := range records {
+		links = append(links, link.redacted())
+	}
+	resp.OK(c, resp.H{
+		"links": links,
+	})
+}
+
+func GetLinkStatuses(c *gin.Context) {
+	resp.OK(c, resp.H{
+		"status": LinkStatuses(linkOwner(c)),
+	})
+}
+
+func addLinkHandler(c *gin.Context, h *hub.Hub) {
+	var link WsLink
+	if err := c.ShouldBindJSON(&link); err != nil {
+		resp.Error(c, "Invalid request")
+		return
+	}
+	if err := checkLink(c, &link); err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	link.ID = uuid.New().String()
+
+	if err := link.Query().Create(&link).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	startLink(h, link)
+
+	resp.OK(c, resp.H{
+		"link": link.redacted(),
+	})
+}
+
+func updateLinkHandler(c *gin.Context, h *hub.Hub) {
+	var link WsLink
+	if err := c.ShouldBindJSON(&link); err != nil || link.ID == "" {
+		resp.Error(c, "Invalid request")
+		return
+	}
+	stored, err := ownedLink(c, link.ID)
+	if err != nil {
+		linkError(c, err)
+		return
+	}
+	if err := checkLink(c, &link); err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	link.keepSecrets(stored)
+	link.CreatedAt = stored.CreatedAt
+
+	if err := link.Query().Save(&link).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	startLink(h, link)
+
+	resp.OK(c, resp.H{
+		"link": link.redacted(),
+	})
+}
+
+func DeleteLink(c *gin.Context) {
+	id := c.Query("id")
+	if _, err := ownedLink(c, id); err != nil {
+		linkError(c, err)
+		return
+	}
+	if err := (&WsLink{}).Query().Where("id = ?", id).Delete(&WsLink{}).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	stopLink(id)
+
+	resp.OK(c, nil)
+}
+
+// setupLinks 注册反向连接接口并启动已保存的连接
+func setupLinks(h *hub.Hub) {
+	models.AutoMigrate(&WsLink{})
+	loadLinks(h)
+
+	authRouter := router.GetAuthRouter()
+	authRouter.GET("/ws/links", GetLinks)
+	authRouter.GET("/ws/links/status", GetLinkStatuses)
+	authRouter.POST("/ws/link", func(c *gin.Context) {
+		addLinkHandler(c, h)
+	})
+	authRouter.PUT("/ws/link", func(c *gin.Context) {
+		updateLinkHandler(c, h)
+	})
+	authRouter.DELETE("/ws/link", DeleteLink)
+}
@@ -0,0 +1,134 @@
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"ultraphx-core/internal/hub"
+)
+
+// WebSocket 控制协议
+//
+// 客户端发送:
+//
+//	{"op": "subscribe", "id": "1", "topic": "data::#"}
+//	{"op": "subscribe", "id": "1", "topic": "data::#", "fromOffset": 100}
+//	{"op": "subscribe", "id": "1", "topic": "data::#", "since": "2024-06-01T00:00:00Z"}
+//	{"op": "unsubscribe", "id": "2", "topic": "data::#"}
+//	{"op": "publish", "id": "3", "message": {"Topic": "data", "Payload": {...}}}
+//	{"op": "ping", "id": "4"}
+//	{"op": "request", "id": "5", "timeout": 5000, "message": {"Topic": "camera::snapshot", "Payload": {...}}}
+//
+// 同一连接同时等待响应的 request 不超过 maxWsRequests 个，超出的 request 直接回复 error。
+//
+// 服务端对每个请求回复 ack 或 error，request 的响应以 reply 帧返回，订阅到的消息以 message 帧推送:
+//
+//	{"op": "ack", "id": "1"}
+//	{"op": "error", "id": "2", "error": "..."}
+//	{"op": "reply", "id": "5", "message": {...}}
+//	{"op": "message", "message": {...}}
+//
+// 带有 fromOffset 或 since 的订阅会先从消息日志中重放历史消息，再切换到实时消息，
+// 重放完成后才回复 ack。切换期间同一条消息可能收到两次，可以根据消息的 Offset 去重。
+//
+// 收到带有 ReplyTo 的消息时，以 publish 向 ReplyTo 发布 CorrelationID 相同的消息即可响应。
+type WsOp string
+
+const (
+	WsOpSubscribe   WsOp = "subscribe"
+	WsOpUnsubscribe WsOp = "unsubscribe"
+	WsOpPublish     WsOp = "publish"
+	WsOpPing        WsOp = "ping"
+	WsOpRequest     WsOp = "request"
+
+	WsOpAck     WsOp = "ack"
+	WsOpError   WsOp = "error"
+	WsOpMessage WsOp = "message"
+	WsOpReply   WsOp = "reply"
+)
+
+type WsFrame struct {
+	Op      WsOp         `json:"op"`
+	ID      string       `json:"id,omitempty"`
+	Topic   string       `json:"topic,omitempty"`
+	Message *hub.Message `json:"message,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Timeout int          `json:"timeout,omitempty"` // request 超时时间，单位为毫秒，不超过 hub.MaxRequestTimeout
+
+	FromOffset uint64     `json:"fromOffset,omitempty"` // 从该偏移量开始重放
+	Since      *time.Time `json:"since,omitempty"`      // 重放该时间之后的消息
+}
+
+func (f *WsFrame) isReplay() bool {
+	return f.Op == WsOpSubscribe && (f.FromOffset > 0 || f.Since != nil)
+}
+
+var (
+	errUnknownOp       = errors.New("unknown op")
+	errMissingMessage  = errors.New("message is required")
+	errJournalDisabled = errors.New("message journal is disabled")
+	errSessionClosed   = errors.New("session closed")
+	errTooManyRequests = fmt.Errorf("too many pending requests, at most %d", maxWsRequests)
+)
+
+func (f *WsFrame) ToJson() []byte {
+	data, _ := json.Marshal(f)
+	return data
+}
+
+func ackFrame(id string) *WsFrame {
+	return &WsFrame{Op: WsOpAck, ID: id}
+}
+
+func errorFrame(id string, err error) *WsFrame {
+	return &WsFrame{Op: WsOpError, ID: id, Error: err.Error()}
+}
+
+func messageFrame(msg *hub.Message) *WsFrame {
+	return &WsFrame{Op: WsOpMessage, Message: msg}
+}
+
+func replyFrame(id string, msg *hub.Message) *WsFrame {
+	return &WsFrame{Op: WsOpReply, ID: id, Message: msg}
+}
+
+// handleRequest 发起请求并等待响应，会阻塞直到收到响应或超时
+func handleRequest(hubClient *hub.Client, frame *WsFrame) *WsFrame {
+	if frame.Message == nil {
+		return errorFrame(frame.ID, errMissingMessage)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hub.RequestTimeout(frame.Timeout))
+	defer cancel()
+
+	reply, err := hubClient.Request(ctx, frame.Message)
+	if err != nil {
+		return errorFrame(frame.ID, err)
+	}
+	return replyFrame(frame.ID, reply)
+}
+
+// handleFrame 处理一个客户端请求帧，返回需要回复的帧
+func handleFrame(hubClient *hub.Client, frame *WsFrame) *WsFrame {
+	switch frame.Op {
+	case WsOpSubscribe:
+		if err := hubClient.Subscribe(frame.Topic); err != nil {
+			return errorFrame(frame.ID, err)
+		}
+	case WsOpUnsubscribe:
+		hubClient.Unsubscribe(frame.Topic)
+	case WsOpPublish:
+		msg := frame.Message
+		if msg == nil {
+			return errorFrame(frame.ID, errMissingMessage)
+		}
+		if err := hubClient.Broadcast(msg); err != nil {
+			return errorFrame(frame.ID, err)
+		}
+	case WsOpPing:
+	default:
+		return errorFrame(frame.ID, errUnknownOp)
+	}
+	return ackFrame(frame.ID)
+}
@@ -0,0 +1,72 @@
+package servers
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"ultraphx-core/internal/hub"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// dialWs 以 client 的身份连接到测试服务器上的 WebSocket 端点
+func dialWs(t *testing.T, h *hub.Hub, topics ...string) *websocket.Conn {
+	t.Helper()
+	client, _ := newTestSensor(t, topics...)
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/ws", func(c *gin.Context) {
+		c.Set("client", client)
+		wsHandler(c, h)
+	})
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestWsRequestLimit(t *testing.T) {
+	h := newTestHub()
+	conn := dialWs(t, h, "rpc::#")
+
+	// 没有响应方的请求会一直等待到超时
+	for i := 0; i <= maxWsRequests; i++ {
+		frame := WsFrame{
+			Op:      WsOpRequest,
+			ID:      strconv.Itoa(i),
+			Timeout: 5000,
+			Message: &hub.Message{Topic: "rpc::nobody"},
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, frame.ToJson()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frame := WsFrame{}
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("no reply to the request over the limit: %v", err)
+	}
+	if frame.Op != WsOpError || frame.ID != strconv.Itoa(maxWsRequests) || frame.Error != errTooManyRequests.Error() {
+		t.Errorf("reply = %+v, want error for request %d", frame, maxWsRequests)
+	}
+
+	// 仍然可以处理其他帧
+	if err := conn.WriteMessage(websocket.TextMessage, (&WsFrame{Op: WsOpPing, ID: "ping"}).ToJson()); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Op != WsOpAck || frame.ID != "ping" {
+		t.Errorf("ping reply = %+v", frame)
+	}
+}
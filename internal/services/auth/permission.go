@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+)
+
+// HubPermissions 将数据库中的授权记录转换为 hub 权限，本地客户端拥有全部权限
+func HubPermissions(client *models.Client) hub.Permissions {
+	if client.Type == models.ClientTypeLocal {
+		return hub.FullPermissions
+	}
+
+	permissions := make(hub.Permissions, 0, len(client.Permissions))
+	for _, p := range client.Permissions {
+		permissions = append(permissions, hub.Permission{
+			Topic: p.Topic,
+			Type:  hub.PermissionType(p.Type),
+		})
+	}
+	return permissions
+}
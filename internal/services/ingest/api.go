@@ -0,0 +1,114 @@
+package ingest
+
+import (
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/pkg/resp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+func checkMapping(m *IngestMapping) error {
+	return hub.ValidateTopicFilter(hubTopic(m.Topic))
+}
+
+func reload() {
+	if err := Reload(); err != nil {
+		logrus.WithError(err).Error("Failed to reload ingest mappings")
+	}
+}
+
+func GetMappings(c *gin.Context) {
+	var mappings []IngestMapping
+	if err := (&IngestMapping{}).Query().Find(&mappings).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+
+	resp.OK(c, resp.H{
+		"mappings": mappings,
+	})
+}
+
+func AddMapping(c *gin.Context) {
+	var mapping IngestMapping
+	if err := c.ShouldBindJSON(&mapping); err != nil {
+		resp.Error(c, "Invalid request")
+		return
+	}
+	if err := checkMapping(&mapping); err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	mapping.ID = uuid.New().String()
+
+	if err := mapping.Query().Create(&mapping).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	reload()
+
+	resp.OK(c, resp.H{
+		"mapping": mapping,
+	})
+}
+
+func UpdateMapping(c *gin.Context) {
+	var mapping IngestMapping
+	if err := c.ShouldBindJSON(&mapping); err != nil || mapping.ID == "" {
+		resp.Error(c, "Invalid request")
+		return
+	}
+	if err := checkMapping(&mapping); err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+
+	if err := mapping.Query().Save(&mapping).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	reload()
+
+	resp.OK(c, resp.H{
+		"mapping": mapping,
+	})
+}
+
+func DeleteMapping(c *gin.Context) {
+	id := c.Query("id")
+	if err := (&IngestMapping{}).Query().Where("id = ?", id).Delete(&IngestMapping{}).Error; err != nil {
+		resp.Error(c, err.Error())
+		return
+	}
+	reload()
+
+	resp.OK(c, nil)
+}
+
+type testMappingRequest struct {
+	Mapping IngestMapping `json:"mapping"`
+	Topic   string        `json:"topic" binding:"required"`
+	Payload string        `json:"payload"`
+}
+
+// TestMapping 使用映射提取一条负载中的指标，不会发布消息
+func TestMapping(c *gin.Context) {
+	var req testMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		resp.Error(c, "Invalid request")
+		return
+	}
+
+	data, err := req.Mapping.Extract(req.Topic, []byte(req.Payload))
+	if err != nil {
+		resp.OK(c, resp.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	resp.OK(c, resp.H{
+		"data": data,
+	})
+}
@@ -0,0 +1,159 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/pkg/global"
+)
+
+// DataTopic 转换后的消息发布到的主题，与主动采集的数据相同
+const DataTopic = "data"
+
+var (
+	errNoValue        = errors.New("no numeric value")
+	errNoClientID     = errors.New("client id is required")
+	errClientMismatch = errors.New("mapping belongs to another client")
+)
+
+type registry struct {
+	mu       sync.RWMutex
+	mappings []IngestMapping
+}
+
+var mappingRegistry = &registry{}
+
+// Reload 从数据库重新加载全部映射
+func Reload() error {
+	var mappings []IngestMapping
+	if err := (&IngestMapping{}).Query().Find(&mappings).Error; err != nil {
+		return err
+	}
+	mappingRegistry.mu.Lock()
+	defer mappingRegistry.mu.Unlock()
+	mappingRegistry.mappings = mappings
+	return nil
+}
+
+// hubTopic 将 MQTT 主题转换为 hub 主题以便复用主题匹配
+func hubTopic(topic string) string {
+	return strings.ReplaceAll(topic, "/", hub.TopicSeparator)
+}
+
+// Matches 判断 MQTT 主题是否配置了接入映射
+func Matches(topic string) bool {
+	mappingRegistry.mu.RLock()
+	defer mappingRegistry.mu.RUnlock()
+	for i := range mappingRegistry.mappings {
+		if hub.MatchTopic(hubTopic(mappingRegistry.mappings[i].Topic), hubTopic(topic)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ingest 使用与 MQTT 主题匹配的映射转换负载，source 为发布者的客户端 ID，
+// trusted 表示发布者为本地客户端或配置文件中的桥接，可以按映射将数据归属于其他客户端，
+// 返回转换得到的 data 消息，没有匹配的映射时返回空
+func Ingest(topic string, payload []byte, source string, trusted bool) []*hub.Message {
+	mappingRegistry.mu.RLock()
+	defer mappingRegistry.mu.RUnlock()
+
+	messages := make([]*hub.Message, 0)
+	for i := range mappingRegistry.mappings {
+		mapping := &mappingRegistry.mappings[i]
+		if !hub.MatchTopic(hubTopic(mapping.Topic), hubTopic(topic)) {
+			continue
+		}
+		msg, err := mapping.Convert(topic, payload, source, trusted)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// Convert 按映射将负载转换为 data 消息，映射指定的客户端与发布者不同时只转换可信发布者的消息
+func (m *IngestMapping) Convert(topic string, payload []byte, source string, trusted bool) (*hub.Message, error) {
+	clientID := m.ClientID
+	if clientID == "" {
+		clientID = source
+	} else if clientID != source && !trusted {
+		return nil, errClientMismatch
+	}
+	if clientID == "" {
+		return nil, errNoClientID
+	}
+
+	data, err := m.Extract(topic, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &hub.Message{
+		Topic:  DataTopic,
+		Source: clientID,
+		Payload: map[string]interface{}{
+			"data": data,
+		},
+	}, nil
+}
+
+// Extract 从负载中提取指标
+func (m *IngestMapping) Extract(topic string, payload []byte) (global.SensorData, error) {
+	value := parsePayload(payload)
+	data := make(global.SensorData)
+
+	if len(m.Fields) == 0 {
+		if obj, ok := value.(map[string]interface{}); ok {
+			for key, v := range obj {
+				if f, ok := global.ToFloat(v); ok {
+					data[key] = f
+				}
+			}
+		} else if f, ok := global.ToFloat(value); ok {
+			levels := strings.Split(topic, "/")
+			data[levels[len(levels)-1]] = f
+		}
+	}
+
+	for _, field := range m.Fields {
+		v, ok := global.LookupPath(value, field.Path)
+		if !ok {
+			continue
+		}
+		f, ok := global.ToFloat(v)
+		if !ok {
+			continue
+		}
+		if field.Scale != 0 {
+			f *= field.Scale
+		}
+		metric := field.Metric
+		if metric == "" {
+			metric = global.PathName(field.Path)
+		}
+		if metric == "" {
+			levels := strings.Split(topic, "/")
+			metric = levels[len(levels)-1]
+		}
+		data[metric] = f
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w in payload of %s", errNoValue, topic)
+	}
+	return data, nil
+}
+
+// parsePayload 解析 JSON 负载，无法解析时作为字符串处理
+func parsePayload(payload []byte) interface{} {
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return strings.TrimSpace(string(payload))
+	}
+	return value
+}
@@ -0,0 +1,30 @@
+package ingest
+
+import (
+	"ultraphx-core/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// IngestMapping 将 MQTT 主题上的原始负载转换为客户端的 data 消息
+type IngestMapping struct {
+	models.Model
+	Name  string `json:"name"`
+	Topic string `json:"topic" binding:"required"` // MQTT 主题，支持 + 与 # 通配符，例如 tele/+/SENSOR
+	// 数据所属的客户端，为空时使用发布者自身的客户端 ID；
+	// 指定时只转换该客户端、本地客户端与桥接发布的消息，其他发布者不能冒用该客户端
+	ClientID string        `json:"clientId"`
+	Fields   []IngestField `json:"fields" gorm:"serializer:json"`
+}
+
+// IngestField 从负载中提取一个指标，Fields 为空时提取 JSON 对象中全部数值字段，
+// 标量负载以主题的最后一级作为指标名
+type IngestField struct {
+	Path   string  `json:"path"`   // 字段路径，例如 ENERGY.Power、values.0 或 JSONPath $.values[0]，为空表示整个负载
+	Metric string  `json:"metric"` // 指标名，为空时使用路径的最后一级
+	Scale  float64 `json:"scale"`  // 单位换算倍数，为 0 时不换算
+}
+
+func (m *IngestMapping) Query() *gorm.DB {
+	return models.DB.Model(m)
+}
@@ -0,0 +1,22 @@
+package ingest
+
+import (
+	"ultraphx-core/internal/models"
+	"ultraphx-core/internal/router"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Setup() {
+	models.AutoMigrate(&IngestMapping{})
+	reload()
+
+	authRouter := router.GetAuthRouter()
+	authRouter.GET("/mqtt/ingest/mappings", GetMappings)
+	authRouter.POST("/mqtt/ingest/mapping", AddMapping)
+	authRouter.PUT("/mqtt/ingest/mapping", UpdateMapping)
+	authRouter.DELETE("/mqtt/ingest/mapping", DeleteMapping)
+	authRouter.POST("/mqtt/ingest/test", TestMapping)
+
+	logrus.Info("MQTT ingest ready")
+}
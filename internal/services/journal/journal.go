@@ -0,0 +1,289 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"ultraphx-core/internal/hub"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 消息日志按偏移量分段保存在目录中，每个分段文件以其第一条消息的偏移量命名，
+// 每行是一条 JSON 格式的 hub.Message。分段超过 SegmentSize 后新建分段，
+// 总大小超过 MaxSize 或最后写入时间早于 MaxAge 的分段会被整体删除。
+const segmentExt = ".log"
+
+var errStop = errors.New("stop")
+
+type Options struct {
+	Dir         string
+	Topics      []string // 需要记录的主题
+	SegmentSize int64
+	MaxSize     int64
+	MaxAge      time.Duration
+}
+
+type segment struct {
+	base    uint64 // 第一条消息的偏移量
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+type Journal struct {
+	opts Options
+
+	mu         sync.RWMutex
+	segments   []*segment
+	active     *os.File
+	nextOffset uint64
+}
+
+func Open(opts Options) (*Journal, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		opts:       opts,
+		nextOffset: 1,
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func segmentName(base uint64) string {
+	return fmt.Sprintf("%020d%s", base, segmentExt)
+}
+
+// load 读取已有分段并恢复下一个偏移量
+func (j *Journal) load() error {
+	entries, err := os.ReadDir(j.opts.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentExt) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		j.segments = append(j.segments, &segment{
+			base:    base,
+			path:    filepath.Join(j.opts.Dir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	sort.Slice(j.segments, func(a, b int) bool {
+		return j.segments[a].base < j.segments[b].base
+	})
+
+	if len(j.segments) == 0 {
+		return j.roll()
+	}
+
+	last := j.segments[len(j.segments)-1]
+	j.nextOffset = last.base
+	err = readSegment(last, func(msg *hub.Message) error {
+		j.nextOffset = msg.Offset + 1
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	j.active, err = os.OpenFile(last.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+// roll 关闭当前分段并新建分段，调用方需持有写锁
+func (j *Journal) roll() error {
+	if j.active != nil {
+		if err := j.active.Close(); err != nil {
+			return err
+		}
+	}
+	seg := &segment{
+		base:    j.nextOffset,
+		path:    filepath.Join(j.opts.Dir, segmentName(j.nextOffset)),
+		modTime: time.Now(),
+	}
+	file, err := os.OpenFile(seg.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	j.active = file
+	j.segments = append(j.segments, seg)
+	j.enforceRetention()
+	return nil
+}
+
+// enforceRetention 删除超出总大小或过期的旧分段，当前分段不会被删除，调用方需持有写锁
+func (j *Journal) enforceRetention() {
+	var total int64
+	for _, seg := range j.segments {
+		total += seg.size
+	}
+
+	for len(j.segments) > 1 {
+		oldest := j.segments[0]
+		expired := j.opts.MaxAge > 0 && time.Since(oldest.modTime) > j.opts.MaxAge
+		oversize := j.opts.MaxSize > 0 && total > j.opts.MaxSize
+		if !expired && !oversize {
+			break
+		}
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).WithField("segment", oldest.path).Error("Failed to remove journal segment")
+			break
+		}
+		total -= oldest.size
+		j.segments = j.segments[1:]
+	}
+}
+
+// Matches 判断主题是否需要记录
+func (j *Journal) Matches(topic string) bool {
+	for _, filter := range j.opts.Topics {
+		if hub.MatchTopic(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Append 记录消息并设置其偏移量，不需要记录的主题会被忽略
+func (j *Journal) Append(msg *hub.Message) error {
+	if !j.Matches(msg.Topic) {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	msg.Offset = j.nextOffset
+	data, err := json.Marshal(msg)
+	if err != nil {
+		msg.Offset = 0
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := j.active.Write(data); err != nil {
+		msg.Offset = 0
+		return err
+	}
+	j.nextOffset++
+
+	seg := j.segments[len(j.segments)-1]
+	seg.size += int64(len(data))
+	seg.modTime = time.Now()
+	if j.opts.SegmentSize > 0 && seg.size >= j.opts.SegmentSize {
+		return j.roll()
+	}
+	return nil
+}
+
+// NextOffset 返回下一条消息的偏移量
+func (j *Journal) NextOffset() uint64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.nextOffset
+}
+
+// Replay 按顺序读取主题匹配 filter 的消息，from 与 since 为零值时不作限制，
+// until 不为 0 时只读取偏移量小于 until 的消息
+func (j *Journal) Replay(filter string, from uint64, since time.Time, until uint64, fn func(msg *hub.Message) error) error {
+	j.mu.RLock()
+	segments := make([]segment, 0, len(j.segments))
+	for _, seg := range j.segments {
+		segments = append(segments, *seg)
+	}
+	j.mu.RUnlock()
+
+	for i := range segments {
+		seg := &segments[i]
+		// 跳过完全早于 from 的分段
+		if i+1 < len(segments) && segments[i+1].base <= from {
+			continue
+		}
+		if !since.IsZero() && seg.modTime.Before(since) {
+			continue
+		}
+		if until != 0 && seg.base >= until {
+			break
+		}
+		err := readSegment(seg, func(msg *hub.Message) error {
+			if msg.Offset < from || msg.Timestamp.Before(since) {
+				return nil
+			}
+			if until != 0 && msg.Offset >= until {
+				return errStop
+			}
+			if !hub.MatchTopic(filter, msg.Topic) {
+				return nil
+			}
+			return fn(msg)
+		})
+		if err == errStop {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSegment 逐条读取分段中的消息，不完整的行会被忽略
+func readSegment(seg *segment, fn func(msg *hub.Message) error) error {
+	file, err := os.Open(seg.path)
+	if os.IsNotExist(err) {
+		// 分段可能已被保留策略删除
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		msg, err := hub.PraseMessageByte(scanner.Bytes())
+		if err != nil || msg.Offset == 0 {
+			continue
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Cleanup 按保留策略删除旧分段
+func (j *Journal) Cleanup() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.enforceRetention()
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.active.Close()
+}
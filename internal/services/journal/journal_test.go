@@ -0,0 +1,282 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ultraphx-core/internal/hub"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	// config 包初始化时在当前目录生成的配置文件
+	os.RemoveAll("config")
+	os.Exit(code)
+}
+
+func openTestJournal(t *testing.T, opts Options) *Journal {
+	t.Helper()
+	if opts.Dir == "" {
+		opts.Dir = t.TempDir()
+	}
+	if opts.Topics == nil {
+		opts.Topics = []string{"#"}
+	}
+	j, err := Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+func appendMessages(t *testing.T, j *Journal, n int, topic func(i int) string) []*hub.Message {
+	t.Helper()
+	msgs := make([]*hub.Message, 0, n)
+	for i := 0; i < n; i++ {
+		msg := &hub.Message{
+			Topic:     topic(i),
+			Timestamp: time.Now().Truncate(time.Second),
+			Payload:   map[string]interface{}{"n": i},
+		}
+		if err := j.Append(msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func dataTopic(i int) string {
+	return "data"
+}
+
+// replayOffsets 返回 Replay 读取到的消息偏移量
+func replayOffsets(t *testing.T, j *Journal, filter string, from uint64, since time.Time, until uint64) []uint64 {
+	t.Helper()
+	offsets := make([]uint64, 0)
+	err := j.Replay(filter, from, since, until, func(msg *hub.Message) error {
+		offsets = append(offsets, msg.Offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offsets
+}
+
+func offsetRange(from, until uint64) []uint64 {
+	offsets := make([]uint64, 0)
+	for offset := from; offset < until; offset++ {
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+func equalOffsets(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentBases 返回目录中分段文件对应的起始偏移量
+func segmentBases(t *testing.T, j *Journal) []uint64 {
+	t.Helper()
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	bases := make([]uint64, 0, len(j.segments))
+	for _, seg := range j.segments {
+		if _, err := os.Stat(filepath.Join(j.opts.Dir, segmentName(seg.base))); err != nil {
+			t.Errorf("segment %d: %v", seg.base, err)
+		}
+		bases = append(bases, seg.base)
+	}
+	return bases
+}
+
+func TestAppendSkipsUnmatchedTopics(t *testing.T) {
+	j := openTestJournal(t, Options{Topics: []string{"data::#"}})
+	msg := &hub.Message{Topic: "command::s1"}
+	if err := j.Append(msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Offset != 0 || j.NextOffset() != 1 {
+		t.Errorf("unmatched message was recorded at offset %d", msg.Offset)
+	}
+}
+
+func TestSegmentRollover(t *testing.T) {
+	dir := t.TempDir()
+	// 每条消息写入后分段都超过上限，每个分段只保存一条消息
+	j := openTestJournal(t, Options{Dir: dir, SegmentSize: 1})
+	msgs := appendMessages(t, j, 5, dataTopic)
+	for i, msg := range msgs {
+		if msg.Offset != uint64(i+1) {
+			t.Errorf("message %d offset = %d, want %d", i, msg.Offset, i+1)
+		}
+	}
+	// 最后一次写入后新建的空分段
+	if got, want := segmentBases(t, j), []uint64{1, 2, 3, 4, 5, 6}; !equalOffsets(got, want) {
+		t.Errorf("segments = %v, want %v", got, want)
+	}
+	j.Close()
+
+	// 重新打开后从最后一个分段恢复偏移量
+	j = openTestJournal(t, Options{Dir: dir, SegmentSize: 1})
+	if got := j.NextOffset(); got != 6 {
+		t.Fatalf("NextOffset after reopen = %d, want 6", got)
+	}
+	appendMessages(t, j, 1, dataTopic)
+	if got, want := replayOffsets(t, j, "#", 0, time.Time{}, 0), offsetRange(1, 7); !equalOffsets(got, want) {
+		t.Errorf("Replay after reopen = %v, want %v", got, want)
+	}
+}
+
+func TestReopenRecoversOffsetFromPartialSegment(t *testing.T) {
+	dir := t.TempDir()
+	j := openTestJournal(t, Options{Dir: dir})
+	appendMessages(t, j, 3, dataTopic)
+	j.Close()
+
+	// 写入中断留下的不完整行会被忽略
+	path := filepath.Join(dir, segmentName(1))
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"Offset":4,"Topic":"da`)
+	file.Close()
+
+	j = openTestJournal(t, Options{Dir: dir})
+	if got := j.NextOffset(); got != 4 {
+		t.Errorf("NextOffset = %d, want 4", got)
+	}
+}
+
+func TestRetentionMaxSize(t *testing.T) {
+	j := openTestJournal(t, Options{SegmentSize: 1})
+	msgs := appendMessages(t, j, 4, dataTopic)
+	size := int64(len(msgs[0].ToJson()) + 1)
+
+	// 只保留能够容纳两条消息的分段，当前分段为空
+	j.opts.MaxSize = 2*size + size/2
+	appendMessages(t, j, 1, dataTopic)
+
+	bases := segmentBases(t, j)
+	if got, want := bases, []uint64{4, 5, 6}; !equalOffsets(got, want) {
+		t.Errorf("segments = %v, want %v", got, want)
+	}
+	for _, base := range []uint64{1, 2, 3} {
+		if _, err := os.Stat(filepath.Join(j.opts.Dir, segmentName(base))); !os.IsNotExist(err) {
+			t.Errorf("segment %d was not removed", base)
+		}
+	}
+	if got, want := replayOffsets(t, j, "#", 0, time.Time{}, 0), []uint64{4, 5}; !equalOffsets(got, want) {
+		t.Errorf("Replay = %v, want %v", got, want)
+	}
+	// 从已删除的偏移量开始重放时返回仍保留的消息
+	if got, want := replayOffsets(t, j, "#", 2, time.Time{}, 0), []uint64{4, 5}; !equalOffsets(got, want) {
+		t.Errorf("Replay from pruned offset = %v, want %v", got, want)
+	}
+}
+
+func TestRetentionMaxAge(t *testing.T) {
+	j := openTestJournal(t, Options{SegmentSize: 1, MaxAge: time.Hour})
+	appendMessages(t, j, 3, dataTopic)
+
+	j.mu.Lock()
+	j.segments[0].modTime = time.Now().Add(-2 * time.Hour)
+	j.segments[1].modTime = time.Now().Add(-2 * time.Hour)
+	j.mu.Unlock()
+	j.Cleanup()
+
+	if got, want := segmentBases(t, j), []uint64{3, 4}; !equalOffsets(got, want) {
+		t.Errorf("segments = %v, want %v", got, want)
+	}
+
+	// 当前分段即使过期也不会被删除
+	j.mu.Lock()
+	for _, seg := range j.segments {
+		seg.modTime = time.Now().Add(-2 * time.Hour)
+	}
+	j.mu.Unlock()
+	j.Cleanup()
+	if got, want := segmentBases(t, j), []uint64{4}; !equalOffsets(got, want) {
+		t.Errorf("segments = %v, want %v", got, want)
+	}
+	appendMessages(t, j, 1, dataTopic)
+	if got, want := replayOffsets(t, j, "#", 0, time.Time{}, 0), []uint64{4}; !equalOffsets(got, want) {
+		t.Errorf("Replay = %v, want %v", got, want)
+	}
+}
+
+func TestReplayAcrossSegments(t *testing.T) {
+	j := openTestJournal(t, Options{})
+	size := int64(len((&hub.Message{Offset: 1, Topic: "data", Timestamp: time.Now().Truncate(time.Second), Payload: map[string]interface{}{"n": 0}}).ToJson()) + 1)
+	// 每个分段保存三条消息
+	j.opts.SegmentSize = 3*size - size/2
+	const n = 10
+	appendMessages(t, j, n, dataTopic)
+
+	if got, want := segmentBases(t, j), []uint64{1, 4, 7, 10}; !equalOffsets(got, want) {
+		t.Fatalf("segments = %v, want %v", got, want)
+	}
+	for from := uint64(0); from <= n+1; from++ {
+		want := offsetRange(max(from, 1), n+1)
+		if got := replayOffsets(t, j, "#", from, time.Time{}, 0); !equalOffsets(got, want) {
+			t.Errorf("Replay from %d = %v, want %v", from, got, want)
+		}
+	}
+	for from := uint64(1); from <= n; from++ {
+		for until := from + 1; until <= n+1; until++ {
+			want := offsetRange(from, until)
+			if got := replayOffsets(t, j, "#", from, time.Time{}, until); !equalOffsets(got, want) {
+				t.Errorf("Replay [%d, %d) = %v, want %v", from, until, got, want)
+			}
+		}
+	}
+}
+
+func TestReplayFilterAndSince(t *testing.T) {
+	j := openTestJournal(t, Options{SegmentSize: 1})
+	start := time.Now().Truncate(time.Second)
+	msgs := appendMessages(t, j, 6, func(i int) string {
+		return fmt.Sprintf("data::s%d", i%2)
+	})
+
+	if got, want := replayOffsets(t, j, "data::s1", 0, time.Time{}, 0), []uint64{2, 4, 6}; !equalOffsets(got, want) {
+		t.Errorf("Replay data::s1 = %v, want %v", got, want)
+	}
+	if got, want := replayOffsets(t, j, "data::s0", 2, time.Time{}, 0), []uint64{3, 5}; !equalOffsets(got, want) {
+		t.Errorf("Replay data::s0 from 2 = %v, want %v", got, want)
+	}
+	if got := replayOffsets(t, j, "data::#", 0, start, 0); len(got) != len(msgs) {
+		t.Errorf("Replay since start = %v, want all messages", got)
+	}
+	if got := replayOffsets(t, j, "data::#", 0, time.Now().Add(time.Hour), 0); len(got) != 0 {
+		t.Errorf("Replay since future = %v, want none", got)
+	}
+}
+
+func TestReplayStopsOnCallbackError(t *testing.T) {
+	j := openTestJournal(t, Options{SegmentSize: 1})
+	appendMessages(t, j, 3, dataTopic)
+
+	errDone := fmt.Errorf("done")
+	count := 0
+	err := j.Replay("#", 0, time.Time{}, 0, func(msg *hub.Message) error {
+		count++
+		return errDone
+	})
+	if err != errDone || count != 1 {
+		t.Errorf("Replay = %v after %d messages, want %v after 1", err, count, errDone)
+	}
+}
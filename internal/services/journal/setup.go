@@ -0,0 +1,45 @@
+package journal
+
+import (
+	"time"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+
+	"github.com/sirupsen/logrus"
+)
+
+var defaultJournal *Journal
+
+// Get 返回已启用的消息日志，未启用时返回 nil
+func Get() *Journal {
+	return defaultJournal
+}
+
+func Setup(h *hub.Hub) {
+	cfg := config.GetJournalConfig()
+	if !cfg.Enabled {
+		return
+	}
+
+	j, err := Open(Options{
+		Dir:         cfg.Dir,
+		Topics:      cfg.Topics,
+		SegmentSize: cfg.SegmentSize,
+		MaxSize:     cfg.MaxSize,
+		MaxAge:      cfg.MaxAge,
+	})
+	if err != nil {
+		logrus.WithError(err).Error("Failed to open message journal")
+		return
+	}
+	defaultJournal = j
+	h.SetJournal(j)
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for range ticker.C {
+			j.Cleanup()
+		}
+	}()
+	logrus.WithField("dir", cfg.Dir).Info("Message journal ready")
+}
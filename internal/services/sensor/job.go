@@ -0,0 +1,343 @@
+package sensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"ultraphx-core/internal/hub"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// 扫描任务
+//
+// StartScan 创建任务后立即返回，任务在后台按并发上限探测全部主机与端口。
+// 可以通过任务状态轮询进度，也可以订阅 hub 主题 sensor::scan::<任务 ID>：
+// 进度以 progress 事件定时发布，发现设备时发布 device 事件，结束时发布 finished 事件。
+const (
+	ScanTopicPrefix      = "sensor::scan"
+	scanProgressInterval = time.Second
+	// 保留的任务数量，超出时删除最早结束的任务
+	maxScanJobs = 16
+	// 同时运行的任务数量上限
+	maxRunningScans = 4
+)
+
+var (
+	errInvalidPort  = errors.New("port must be between 1 and 65535")
+	errTooManyScans = fmt.Errorf("too many running scans, at most %d", maxRunningScans)
+)
+
+type ScanState string
+
+const (
+	ScanStateRunning   ScanState = "running"
+	ScanStateFinished  ScanState = "finished"
+	ScanStateCancelled ScanState = "cancelled"
+)
+
+type ScanJobStatus struct {
+	ID         string      `json:"id"`
+	State      ScanState   `json:"state"`
+	Options    ScanOptions `json:"options"`
+	Total      int         `json:"total"`   // 需要探测的地址数，即主机数乘以端口数
+	Scanned    int         `json:"scanned"` // 已探测的地址数
+	Found      int         `json:"found"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	Devices    []Device    `json:"devices"`
+}
+
+// ScanJob 一次扫描任务
+type ScanJob struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status ScanJobStatus
+	unseen []Device // 此前没有扫描到过的设备
+}
+
+var (
+	scanHub *hub.Hub
+
+	jobsMu   sync.Mutex
+	jobs     = make(map[string]*ScanJob)
+	jobOrder []string
+)
+
+// StartScan 创建并启动扫描任务
+func StartScan(opts ScanOptions) (*ScanJob, error) {
+	opts.setDefaults()
+	ports := make([]int, 0, len(opts.Ports))
+	seen := make(map[int]bool)
+	for _, port := range opts.Ports {
+		if port <= 0 || port > 65535 {
+			return nil, errInvalidPort
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) > maxScanPorts {
+		return nil, errTooManyPorts
+	}
+	opts.Ports = ports
+	networks, err := parseNetworks(opts.CIDRs)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := scanTargets(networks)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts)*len(opts.Ports) > maxScanProbes {
+		return nil, errTooManyProbe
+	}
+	if len(opts.CIDRs) == 0 {
+		for _, network := range networks {
+			opts.CIDRs = append(opts.CIDRs, network.String())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &ScanJob{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: ScanJobStatus{
+			ID:        uuid.New().String(),
+			State:     ScanStateRunning,
+			Options:   opts,
+			Total:     len(hosts) * len(opts.Ports),
+			StartedAt: time.Now(),
+			Devices:   make([]Device, 0),
+		},
+	}
+	if err := addJob(job); err != nil {
+		cancel()
+		return nil, err
+	}
+	go job.run(hosts)
+	logrus.WithField("job", job.status.ID).WithField("networks", opts.CIDRs).Infof("Sensor scan started, %d addresses", job.status.Total)
+	return job, nil
+}
+
+// addJob 保存任务，正在运行的任务达到上限时返回错误
+func addJob(job *ScanJob) error {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	running := 0
+	for _, old := range jobs {
+		if old.Status().State == ScanStateRunning {
+			running++
+		}
+	}
+	if running >= maxRunningScans {
+		return errTooManyScans
+	}
+	jobs[job.status.ID] = job
+	jobOrder = append(jobOrder, job.status.ID)
+
+	// 删除最早结束的任务，正在运行的任务不会被删除
+	for i := 0; len(jobs) > maxScanJobs && i < len(jobOrder); {
+		old := jobs[jobOrder[i]]
+		if old.Status().State == ScanStateRunning {
+			i++
+			continue
+		}
+		delete(jobs, jobOrder[i])
+		jobOrder = append(jobOrder[:i], jobOrder[i+1:]...)
+	}
+	return nil
+}
+
+// GetScanJob 按 ID 返回扫描任务
+func GetScanJob(id string) (*ScanJob, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	job, ok := jobs[id]
+	return job, ok
+}
+
+// ScanJobs 返回全部保留的扫描任务状态，按创建时间排序
+func ScanJobs() []ScanJobStatus {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	statuses := make([]ScanJobStatus, 0, len(jobOrder))
+	for _, id := range jobOrder {
+		statuses = append(statuses, jobs[id].Status())
+	}
+	return statuses
+}
+
+func (j *ScanJob) ID() string {
+	return j.status.ID
+}
+
+// Status 返回任务状态的副本
+func (j *ScanJob) Status() ScanJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	status.Devices = append([]Device{}, j.status.Devices...)
+	return status
+}
+
+// Cancel 取消任务，已发现的设备会保留
+func (j *ScanJob) Cancel() {
+	j.cancel()
+}
+
+// Wait 等待任务结束并返回发现的设备
+func (j *ScanJob) Wait() []Device {
+	<-j.done
+	return j.Status().Devices
+}
+
+func (j *ScanJob) topic() string {
+	return ScanTopicPrefix + hub.TopicSeparator + j.status.ID
+}
+
+func (j *ScanJob) publish(event string, extra map[string]interface{}) {
+	if scanHub == nil {
+		return
+	}
+	status := j.Status()
+	payload := map[string]interface{}{
+		"event":   event,
+		"id":      status.ID,
+		"state":   status.State,
+		"total":   status.Total,
+		"scanned": status.Scanned,
+		"found":   status.Found,
+	}
+	for key, value := range extra {
+		payload[key] = value
+	}
+	scanHub.Broadcast(&hub.Message{
+		Topic:   j.topic(),
+		Payload: payload,
+	})
+}
+
+type scanTarget struct {
+	ip   string
+	port int
+}
+
+// run 以固定数量的 worker 探测全部地址
+func (j *ScanJob) run(hosts []string) {
+	defer close(j.done)
+	opts := j.status.Options
+	dialTimeout := time.Duration(opts.DialTimeout) * time.Millisecond
+	httpClient := &http.Client{
+		Timeout: time.Duration(opts.ProbeTimeout) * time.Millisecond,
+	}
+
+	targets := make(chan scanTarget)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range targets {
+				j.probe(httpClient, target, dialTimeout)
+			}
+		}()
+	}
+
+	stopProgress := make(chan struct{})
+	go j.reportProgress(stopProgress)
+
+feed:
+	for _, host := range hosts {
+		for _, port := range opts.Ports {
+			select {
+			case targets <- scanTarget{ip: host, port: port}:
+			case <-j.ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(targets)
+	wg.Wait()
+	close(stopProgress)
+
+	now := time.Now()
+	j.mu.Lock()
+	j.status.State = ScanStateFinished
+	if j.ctx.Err() != nil {
+		j.status.State = ScanStateCancelled
+	}
+	j.status.FinishedAt = &now
+	j.mu.Unlock()
+	j.cancel()
+
+	status := j.Status()
+	j.publish("finished", map[string]interface{}{
+		"devices": status.Devices,
+	})
+	logrus.WithField("job", status.ID).Infof("Sensor scan %s, %d devices found", status.State, status.Found)
+}
+
+func (j *ScanJob) probe(httpClient *http.Client, target scanTarget, dialTimeout time.Duration) {
+	if j.ctx.Err() != nil {
+		return
+	}
+	var device *Device
+	if isPortOpen(j.ctx, net.JoinHostPort(target.ip, strconv.Itoa(target.port)), dialTimeout) {
+		device = probeDevice(j.ctx, httpClient, target.ip, target.port)
+	}
+
+	var unseen []Device
+	if device != nil {
+		found := []Device{*device}
+		unseen = deviceRegistry.remember(found)
+		device = &found[0]
+	}
+
+	j.mu.Lock()
+	j.status.Scanned++
+	if device != nil {
+		j.status.Found++
+		j.status.Devices = append(j.status.Devices, *device)
+		j.unseen = append(j.unseen, unseen...)
+	}
+	j.mu.Unlock()
+
+	if device != nil {
+		j.publish("device", map[string]interface{}{
+			"device": devicePayload(*device),
+		})
+	}
+}
+
+// reportProgress 定时发布进度，直到 stop 被关闭
+func (j *ScanJob) reportProgress(stop <-chan struct{}) {
+	ticker := time.NewTicker(scanProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			j.publish("progress", nil)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// unseenDevices 返回本次任务中首次扫描到的设备
+func (j *ScanJob) unseenDevices() []Device {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Device{}, j.unseen...)
+}
@@ -0,0 +1,73 @@
+package sensor
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	// config 包初始化时在当前目录生成的配置文件
+	os.RemoveAll("config")
+	os.Exit(code)
+}
+
+// localScanOptions 返回只扫描 server 所在地址与端口的参数
+func localScanOptions(t *testing.T, server *httptest.Server) ScanOptions {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ScanOptions{CIDRs: []string{host}, Ports: []int{portNum}}
+}
+
+func TestStartScanLimitsRunningJobs(t *testing.T) {
+	// 设备在测试放行前不返回元数据，使任务保持运行
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"metadata": {"name": "slow"}}`))
+	}))
+	defer server.Close()
+	opts := localScanOptions(t, server)
+
+	running := make([]*ScanJob, 0, maxRunningScans)
+	for i := 0; i < maxRunningScans; i++ {
+		job, err := StartScan(opts)
+		if err != nil {
+			t.Fatalf("scan %d: %v", i, err)
+		}
+		running = append(running, job)
+	}
+	if _, err := StartScan(opts); !errors.Is(err, errTooManyScans) {
+		t.Fatalf("StartScan at limit = %v, want %v", err, errTooManyScans)
+	}
+
+	// 取消的任务结束后不再占用名额
+	running[0].Cancel()
+	running[0].Wait()
+	job, err := StartScan(opts)
+	if err != nil {
+		t.Fatalf("StartScan after cancel: %v", err)
+	}
+	running[0] = job
+
+	close(release)
+	for _, job := range running {
+		if devices := job.Wait(); len(devices) != 1 || devices[0].Name != "slow" {
+			t.Errorf("job %s found %+v", job.ID(), devices)
+		}
+	}
+	job, err = StartScan(opts)
+	if err != nil {
+		t.Fatalf("StartScan after jobs finished: %v", err)
+	}
+	job.Wait()
+}
@@ -0,0 +1,251 @@
+package sensor
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"ultraphx-core/internal/hub"
+
+	"github.com/grandcat/zeroconf"
+	"github.com/sirupsen/logrus"
+)
+
+// mDNS 发现
+//
+// 每轮分别浏览配置中的 DNS-SD 服务类型，从 TXT 记录读取 name、version 与 metadata（元数据路径），
+// 再读取设备的元数据文档补全端点信息。_ultraphx._tcp 的实例一定视为设备，
+// 其他服务类型（如 _http._tcp）的实例只有 TXT 记录中带有 ultraphx 键时才视为设备并读取元数据，
+// 不会向打印机、路由器等其他主机发送请求。读取的元数据会缓存，设备的 version 变化时重新读取。
+// 发现的设备与扫描结果共用同一个 registry，同一地址的信息会被合并。
+const (
+	UltraphxService = "_ultraphx._tcp"
+	mdnsDomain      = "local."
+	// 标记 UltraPhoenix 设备的 TXT 键
+	mdnsMarkerKey = "ultraphx"
+	// 每种服务的浏览时长
+	mdnsBrowseWindow = 3 * time.Second
+	// 连续若干轮没有响应的设备从发现列表中移除
+	mdnsExpireRounds = 3
+	// 元数据的缓存时长，读取失败时在较短的时间后重试
+	mdnsMetadataTTL   = 10 * time.Minute
+	mdnsMetadataRetry = time.Minute
+)
+
+type liveDevice struct {
+	id      string
+	expires time.Time
+}
+
+// 当前仍在广播的设备，以 host:port 为键
+var discovered = struct {
+	mu      sync.RWMutex
+	devices map[string]liveDevice
+}{devices: make(map[string]liveDevice)}
+
+type cachedMetadata struct {
+	device  Device // 只包含元数据中的字段
+	err     error
+	expires time.Time
+}
+
+// 设备元数据的缓存，以 host:port、元数据路径与 version 为键
+var metadataCache = struct {
+	mu      sync.Mutex
+	entries map[string]cachedMetadata
+}{entries: make(map[string]cachedMetadata)}
+
+// cachedFetchMetadata 读取设备的元数据，缓存未过期时直接返回缓存的结果
+func cachedFetchMetadata(ctx context.Context, client *http.Client, device Device, path, version string) (Device, error) {
+	key := device.Address() + "|" + path + "|" + version
+	now := time.Now()
+	metadataCache.mu.Lock()
+	cached, ok := metadataCache.entries[key]
+	metadataCache.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.device, cached.err
+	}
+
+	metadata := Device{IP: device.IP, Port: device.Port}
+	err := fetchMetadata(ctx, client, &metadata, path)
+	ttl := mdnsMetadataTTL
+	if err != nil {
+		ttl = mdnsMetadataRetry
+	}
+	metadataCache.mu.Lock()
+	metadataCache.entries[key] = cachedMetadata{device: metadata, err: err, expires: now.Add(ttl)}
+	metadataCache.mu.Unlock()
+	return metadata, err
+}
+
+// pruneMetadataCache 删除过期的元数据缓存
+func pruneMetadataCache() {
+	now := time.Now()
+	metadataCache.mu.Lock()
+	defer metadataCache.mu.Unlock()
+	for key, cached := range metadataCache.entries {
+		if now.After(cached.expires) {
+			delete(metadataCache.entries, key)
+		}
+	}
+}
+
+// parseTXT 解析 TXT 记录，键不区分大小写，没有值的键视为空字符串
+func parseTXT(records []string) map[string]string {
+	txt := make(map[string]string, len(records))
+	for _, record := range records {
+		key, value, _ := strings.Cut(record, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		if _, ok := txt[key]; !ok {
+			txt[key] = value
+		}
+	}
+	return txt
+}
+
+// entryDevice 将 DNS-SD 服务实例转换为设备，不是 UltraPhoenix 设备的实例返回 nil
+func entryDevice(ctx context.Context, client *http.Client, service string, entry *zeroconf.ServiceEntry) *Device {
+	if len(entry.AddrIPv4) == 0 || entry.Port <= 0 {
+		return nil
+	}
+	txt := parseTXT(entry.Text)
+	if _, marked := txt[mdnsMarkerKey]; service != UltraphxService && !marked {
+		return nil
+	}
+	device := Device{
+		IP:       entry.AddrIPv4[0].String(),
+		Port:     entry.Port,
+		Name:     txt["name"],
+		Instance: entry.Instance,
+	}
+	if device.Name == "" {
+		device.Name = entry.Instance
+	}
+	if version, err := strconv.Atoi(txt["version"]); err == nil {
+		device.Version = version
+	}
+
+	path := txt["metadata"]
+	if path == "" {
+		path = defaultMetadataPath
+	}
+	metadata, err := cachedFetchMetadata(ctx, client, device, path, txt["version"])
+	if err != nil {
+		logrus.WithError(err).WithField("instance", entry.Instance).Debug("Failed to read metadata of mDNS device")
+		return &device
+	}
+	merged := mergeDevice(device, metadata)
+	return &merged
+}
+
+// browseService 在浏览时长内收集一种服务类型的实例
+func browseService(service string) ([]*zeroconf.ServiceEntry, error) {
+	resolver, err := zeroconf.NewResolver(nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mdnsBrowseWindow)
+	defer cancel()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, service, mdnsDomain, entries); err != nil {
+		return nil, err
+	}
+	found := make([]*zeroconf.ServiceEntry, 0)
+	for entry := range entries {
+		found = append(found, entry)
+	}
+	return found, nil
+}
+
+// browseRound 浏览一轮全部服务类型，返回发现的设备，同一地址只保留一个
+func browseRound(services []string) []Device {
+	httpClient := &http.Client{Timeout: defaultProbeTimeout}
+	pruneMetadataCache()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		devices = make(map[string]Device)
+	)
+	for _, service := range services {
+		entries, err := browseService(service)
+		if err != nil {
+			logrus.WithError(err).WithField("service", service).Warn("Failed to browse mDNS service")
+			continue
+		}
+		for _, entry := range entries {
+			wg.Add(1)
+			go func(service string, entry *zeroconf.ServiceEntry) {
+				defer wg.Done()
+				device := entryDevice(context.Background(), httpClient, service, entry)
+				if device == nil {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if old, ok := devices[device.Address()]; ok {
+					*device = mergeDevice(old, *device)
+				}
+				devices[device.Address()] = *device
+			}(service, entry)
+		}
+	}
+	wg.Wait()
+
+	found := make([]Device, 0, len(devices))
+	for _, device := range devices {
+		found = append(found, device)
+	}
+	return found
+}
+
+// updateDiscovered 刷新发现列表并移除过期的设备
+func updateDiscovered(devices []Device, ttl time.Duration) {
+	now := time.Now()
+	discovered.mu.Lock()
+	defer discovered.mu.Unlock()
+	for _, device := range devices {
+		discovered.devices[device.Address()] = liveDevice{id: device.ID, expires: now.Add(ttl)}
+	}
+	for address, device := range discovered.devices {
+		if now.After(device.expires) {
+			logrus.WithField("address", address).Info("mDNS device is no longer advertised")
+			delete(discovered.devices, address)
+		}
+	}
+}
+
+// DiscoveredDevices 返回当前通过 mDNS 发现的设备，按地址排序，返回的 ID 可用于收编
+func DiscoveredDevices() []Device {
+	discovered.mu.RLock()
+	defer discovered.mu.RUnlock()
+	devices := make([]Device, 0, len(discovered.devices))
+	for _, live := range discovered.devices {
+		if device, ok := GetDevice(live.id); ok {
+			devices = append(devices, device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Address() < devices[j].Address()
+	})
+	return devices
+}
+
+// browseMdns 定时浏览 mDNS 服务，发现既未见过也未登记的设备时发布 sensor::discovered 消息
+func browseMdns(h *hub.Hub, interval time.Duration, services []string) {
+	ttl := interval * mdnsExpireRounds
+	for {
+		devices := browseRound(services)
+		unseen := deviceRegistry.remember(devices)
+		updateDiscovered(devices, ttl)
+		announce(h, unseen, "mdns")
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,216 @@
+package sensor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// 测试使用的服务类型，不是 _ultraphx._tcp，实例需要带有标记才会被视为设备
+const testMdnsService = "_uphxtest._tcp"
+
+func resetMetadataCache(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		metadataCache.mu.Lock()
+		metadataCache.entries = make(map[string]cachedMetadata)
+		metadataCache.mu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// metadataServer 返回元数据并记录请求次数
+type metadataServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func startMetadataServer(t *testing.T, listen, path, body string) *metadataServer {
+	t.Helper()
+	listener, err := net.Listen("tcp4", listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &metadataServer{}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	s.Listener.Close()
+	s.Listener = listener
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *metadataServer) port() int {
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+const testMetadata = `{"metadata": {"name": "thermo", "description": "room sensor", "version": 2},
+	"entrypoints": [{"path": "/data/json", "method": "GET", "type": "json"}]}`
+
+func TestParseTXT(t *testing.T) {
+	tests := []struct {
+		records []string
+		want    map[string]string
+	}{
+		{nil, map[string]string{}},
+		{[]string{"name=thermo", "version=2"}, map[string]string{"name": "thermo", "version": "2"}},
+		// 键不区分大小写，值保持原样
+		{[]string{"Name=Thermo One", " METADATA =/meta"}, map[string]string{"name": "Thermo One", "metadata": "/meta"}},
+		// 没有值的键视为空字符串，值中可以包含 =
+		{[]string{"ultraphx", "path=/a=b"}, map[string]string{"ultraphx": "", "path": "/a=b"}},
+		// 重复的键只取第一个，空键被忽略
+		{[]string{"name=a", "NAME=b", "=x", ""}, map[string]string{"name": "a"}},
+	}
+	for _, tt := range tests {
+		if got := parseTXT(tt.records); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTXT(%q) = %v, want %v", tt.records, got, tt.want)
+		}
+	}
+}
+
+func testEntry(service string, port int, text ...string) *zeroconf.ServiceEntry {
+	entry := zeroconf.NewServiceEntry("thermo-1", service, mdnsDomain)
+	entry.AddrIPv4 = []net.IP{net.IPv4(127, 0, 0, 1)}
+	entry.Port = port
+	entry.Text = text
+	return entry
+}
+
+func TestEntryDevice(t *testing.T) {
+	resetMetadataCache(t)
+	server := startMetadataServer(t, "127.0.0.1:0", "/meta", testMetadata)
+	ctx := context.Background()
+	client := server.Client()
+
+	// 没有地址或端口的实例
+	entry := testEntry(UltraphxService, server.port())
+	entry.AddrIPv4 = nil
+	if device := entryDevice(ctx, client, UltraphxService, entry); device != nil {
+		t.Errorf("entry without address = %+v, want nil", device)
+	}
+	if device := entryDevice(ctx, client, UltraphxService, testEntry(UltraphxService, 0)); device != nil {
+		t.Errorf("entry without port = %+v, want nil", device)
+	}
+
+	// 其他服务类型没有标记时不读取元数据
+	if device := entryDevice(ctx, client, "_http._tcp", testEntry("_http._tcp", server.port(), "metadata=/meta")); device != nil {
+		t.Errorf("unmarked entry = %+v, want nil", device)
+	}
+	if n := server.requests.Load(); n != 0 {
+		t.Fatalf("unmarked entry made %d requests, want 0", n)
+	}
+
+	// 带有标记的实例读取 TXT 中指定的元数据路径
+	device := entryDevice(ctx, client, "_http._tcp", testEntry("_http._tcp", server.port(), "ultraphx=1", "metadata=/meta", "version=2"))
+	want := Device{
+		IP:          "127.0.0.1",
+		Port:        server.port(),
+		Name:        "thermo",
+		Description: "room sensor",
+		Version:     2,
+		Endpoints:   []Entrypoint{{Path: "/data/json", Method: "GET", Type: "json"}},
+		Instance:    "thermo-1",
+	}
+	if device == nil || !reflect.DeepEqual(*device, want) {
+		t.Fatalf("marked entry = %+v, want %+v", device, want)
+	}
+
+	// 元数据被缓存，version 变化时重新读取
+	entryDevice(ctx, client, UltraphxService, testEntry(UltraphxService, server.port(), "metadata=/meta", "version=2"))
+	if n := server.requests.Load(); n != 1 {
+		t.Errorf("metadata requested %d times, want 1", n)
+	}
+	entryDevice(ctx, client, UltraphxService, testEntry(UltraphxService, server.port(), "metadata=/meta", "version=3"))
+	if n := server.requests.Load(); n != 2 {
+		t.Errorf("metadata requested %d times after version change, want 2", n)
+	}
+
+	// _ultraphx._tcp 的实例读取元数据失败时使用 TXT 中的信息
+	device = entryDevice(ctx, client, UltraphxService, testEntry(UltraphxService, server.port(), "name=Fallback", "version=5"))
+	want = Device{IP: "127.0.0.1", Port: server.port(), Name: "Fallback", Version: 5, Instance: "thermo-1"}
+	if device == nil || !reflect.DeepEqual(*device, want) {
+		t.Errorf("entry without metadata = %+v, want %+v", device, want)
+	}
+}
+
+// hasMulticastInterface 判断是否有可以收发 mDNS 的网卡
+func hasMulticastInterface() bool {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return false
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 && iface.Flags&net.FlagLoopback == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBrowseRound(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mDNS browsing takes several seconds")
+	}
+	if !hasMulticastInterface() {
+		t.Skip("no multicast network interface")
+	}
+	resetMetadataCache(t)
+
+	marked := startMetadataServer(t, "0.0.0.0:0", defaultMetadataPath, testMetadata)
+	unmarked := startMetadataServer(t, "0.0.0.0:0", defaultMetadataPath, testMetadata)
+	for _, r := range []struct {
+		instance string
+		port     int
+		text     []string
+	}{
+		{"uphx-marked", marked.port(), []string{"ultraphx=1", "version=2"}},
+		{"uphx-unmarked", unmarked.port(), []string{"version=2"}},
+	} {
+		responder, err := zeroconf.Register(r.instance, testMdnsService, mdnsDomain, r.port, r.text, nil)
+		if err != nil {
+			t.Skipf("mDNS responder unavailable: %v", err)
+		}
+		t.Cleanup(responder.Shutdown)
+	}
+
+	for round := 1; round <= 2; round++ {
+		devices := browseRound([]string{testMdnsService})
+		var found []Device
+		for _, device := range devices {
+			if device.Port == marked.port() || device.Port == unmarked.port() {
+				found = append(found, device)
+			}
+		}
+		if len(found) != 1 {
+			t.Fatalf("round %d: found %+v, want the marked device only", round, found)
+		}
+		if device := found[0]; device.Port != marked.port() || device.Name != "thermo" || device.Instance != "uphx-marked" || len(device.Endpoints) != 1 {
+			t.Errorf("round %d: device = %+v", round, device)
+		}
+	}
+
+	// 只向带有标记的主机读取元数据，第二轮使用缓存
+	if n := marked.requests.Load(); n != 1 {
+		t.Errorf("marked device metadata requested %d times, want 1", n)
+	}
+	if n := unmarked.requests.Load(); n != 0 {
+		t.Errorf("unmarked host received %d requests, want 0", n)
+	}
+}
@@ -0,0 +1,149 @@
+package sensor
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+	"ultraphx-core/internal/config"
+	"ultraphx-core/internal/hub"
+	"ultraphx-core/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// DiscoveredTopic 后台扫描或 mDNS 发现未知设备时发布的主题
+const DiscoveredTopic = "sensor::discovered"
+
+// 扫描或 mDNS 发现的设备，按地址保持 ID 不变，用于按 ID 收编设备
+type registry struct {
+	mu      sync.RWMutex
+	devices map[string]Device // 以 ID 为键
+	ids     map[string]string // host:port 到 ID
+}
+
+var deviceRegistry = &registry{
+	devices: make(map[string]Device),
+	ids:     make(map[string]string),
+}
+
+// mergeDevice 合并同一地址的设备信息，新结果中为空的字段保留原值
+func mergeDevice(old, device Device) Device {
+	if device.Name == "" || device.Name == device.IP {
+		device.Name = old.Name
+	}
+	if device.Description == "" {
+		device.Description = old.Description
+	}
+	if device.Version == 0 {
+		device.Version = old.Version
+	}
+	if len(device.Endpoints) == 0 {
+		device.Endpoints = old.Endpoints
+	}
+	if device.Instance == "" {
+		device.Instance = old.Instance
+	}
+	return device
+}
+
+// remember 记录扫描或 mDNS 发现的设备并分配 ID，同一地址的结果会被合并，返回此前没有见过的设备
+func (r *registry) remember(devices []Device) []Device {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unseen := make([]Device, 0)
+	for i := range devices {
+		id, ok := r.ids[devices[i].Address()]
+		if !ok {
+			id = uuid.New().String()
+			r.ids[devices[i].Address()] = id
+		} else {
+			devices[i] = mergeDevice(r.devices[id], devices[i])
+		}
+		devices[i].ID = id
+		devices[i].LastSeen = time.Now()
+		r.devices[id] = devices[i]
+		if !ok {
+			unseen = append(unseen, devices[i])
+		}
+	}
+	return unseen
+}
+
+// GetDevice 按 ID 返回扫描到的设备
+func GetDevice(id string) (Device, bool) {
+	deviceRegistry.mu.RLock()
+	defer deviceRegistry.mu.RUnlock()
+	device, ok := deviceRegistry.devices[id]
+	return device, ok
+}
+
+// RegisteredIPs 返回已经登记为主动传感器的 IP 地址
+func RegisteredIPs() map[string]bool {
+	var infos []models.CollectionInfo
+	ips := make(map[string]bool)
+	if err := (&models.CollectionInfo{}).Query().Select("ip_address").Find(&infos).Error; err != nil {
+		logrus.WithError(err).Error("Failed to load registered sensor addresses")
+		return ips
+	}
+	for _, info := range infos {
+		if info.IPAddress != "" {
+			ips[info.IPAddress] = true
+		}
+	}
+	return ips
+}
+
+// backgroundScan 定时扫描局域网，发现既未见过也未登记的设备时发布 sensor::discovered 消息
+func backgroundScan(h *hub.Hub, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		job, err := StartScan(ScanOptions{})
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to start background sensor scan")
+			continue
+		}
+		job.Wait()
+		announce(h, job.unseenDevices(), "scan")
+	}
+}
+
+// announce 为尚未登记的新设备发布 sensor::discovered 消息，source 为发现方式
+func announce(h *hub.Hub, devices []Device, source string) {
+	if len(devices) == 0 {
+		return
+	}
+	registered := RegisteredIPs()
+	for _, device := range devices {
+		if registered[device.IP] {
+			continue
+		}
+		logrus.WithField("ip", device.IP).WithField("source", source).Info("New device discovered: ", device.Name)
+		payload := devicePayload(device)
+		payload["source"] = source
+		h.Broadcast(&hub.Message{
+			Topic:   DiscoveredTopic,
+			Payload: payload,
+		})
+	}
+}
+
+func devicePayload(device Device) map[string]interface{} {
+	payload := make(map[string]interface{})
+	data, _ := json.Marshal(device)
+	json.Unmarshal(data, &payload)
+	return payload
+}
+
+// Setup 设置发布扫描进度的 hub 并启动后台扫描与 mDNS 发现，间隔为 0 时不启动对应的任务
+func Setup(h *hub.Hub) {
+	scanHub = h
+	cfg := config.GetSensorConfig()
+	if cfg.ScanInterval > 0 {
+		go backgroundScan(h, cfg.ScanInterval)
+	}
+	if cfg.MdnsEnabled && cfg.MdnsInterval > 0 && len(cfg.MdnsServices) > 0 {
+		go browseMdns(h, cfg.MdnsInterval, cfg.MdnsServices)
+	}
+}
@@ -1,13 +1,16 @@
 package sensor
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -37,93 +40,201 @@ type DeviceData struct {
 }
 
 type Device struct {
+	ID          string       `json:"id"`
 	IP          string       `json:"ip"`
+	Port        int          `json:"port"`
 	Name        string       `json:"name"`
 	Description string       `json:"description"`
 	Version     int          `json:"version"`
 	Endpoints   []Entrypoint `json:"endpoints"`
+	Instance    string       `json:"instance,omitempty"` // mDNS 服务实例名
+	LastSeen    time.Time    `json:"lastSeen"`
 }
 
-var wg sync.WaitGroup
-
-func ScanSensors() []Device {
-	devices := make([]Device, 0)
-	ips := getLocalIPs()
+// Address 返回设备的 host:port
+func (d Device) Address() string {
+	port := d.Port
+	if port == 0 {
+		port = defaultScanPort
+	}
+	return net.JoinHostPort(d.IP, strconv.Itoa(port))
+}
 
-	for _, ip := range ips {
-		wg.Add(1)
-		go scanNetwork(ip, &devices)
+// URL 返回设备上某个端点的地址
+func (d Device) URL(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if d.Port == 0 || d.Port == defaultScanPort {
+		return "http://" + d.IP + path
 	}
+	return "http://" + d.Address() + path
+}
 
-	wg.Wait()
+const (
+	defaultScanPort        = 80
+	defaultMetadataPath    = "/metadata"
+	defaultScanConcurrency = 64
+	defaultDialTimeout     = time.Second
+	defaultProbeTimeout    = 3 * time.Second
+	// 同时探测的数量上限
+	maxScanConcurrency = 256
+	// 单次扫描的端口数上限
+	maxScanPorts = 16
+	// 单次扫描的探测次数（主机数乘以端口数）上限
+	maxScanProbes = 1 << 18
+	// 单次扫描的主机数上限
+	maxScanHosts = 1 << 16
+	// 网卡子网大于 /16 时只扫描本机所在的 /16
+	minLocalPrefix = 16
+)
 
-	return devices
+var (
+	errNoNetworks   = errors.New("no IPv4 network to scan")
+	errTooManyHosts = fmt.Errorf("too many hosts to scan, at most %d", maxScanHosts)
+	errTooManyPorts = fmt.Errorf("too many ports to scan, at most %d", maxScanPorts)
+	errTooManyProbe = fmt.Errorf("too many addresses to scan, at most %d hosts times ports", maxScanProbes)
+)
+
+// ScanOptions 扫描参数，为零值的字段使用默认值
+type ScanOptions struct {
+	CIDRs        []string `json:"cidrs"`        // 需要扫描的 IPv4 网段，为空时扫描本机各网卡所在的子网
+	Ports        []int    `json:"ports"`        // 需要探测的端口，默认为 80，最多 16 个
+	Concurrency  int      `json:"concurrency"`  // 同时探测的数量上限，默认为 64，最大为 256
+	DialTimeout  int      `json:"dialTimeout"`  // 端口连接超时，单位为毫秒，默认为 1000
+	ProbeTimeout int      `json:"probeTimeout"` // 读取设备元数据的超时，单位为毫秒，默认为 3000
+}
+
+func (o *ScanOptions) setDefaults() {
+	if len(o.Ports) == 0 {
+		o.Ports = []int{defaultScanPort}
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultScanConcurrency
+	}
+	o.Concurrency = min(o.Concurrency, maxScanConcurrency)
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = int(defaultDialTimeout / time.Millisecond)
+	}
+	if o.ProbeTimeout <= 0 {
+		o.ProbeTimeout = int(defaultProbeTimeout / time.Millisecond)
+	}
 }
 
-func getLocalIPs() []string {
-	var ips []string
+// localNetworks 返回本机各网卡所在的 IPv4 子网，子网大小取自网卡的掩码
+func localNetworks() []*net.IPNet {
+	networks := make([]*net.IPNet, 0)
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		fmt.Println(err)
-		return ips
+		logrus.WithError(err).Error("Failed to list network interfaces")
+		return networks
 	}
 
+	seen := make(map[string]bool)
 	for _, iface := range ifaces {
 		// 跳过 br-、veth、docker
 		if strings.HasPrefix(iface.Name, "br") || strings.HasPrefix(iface.Name, "veth") || strings.HasPrefix(iface.Name, "docker") {
 			continue
 		}
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
 		addrs, err := iface.Addrs()
 		if err != nil {
-			fmt.Println(err)
+			logrus.WithError(err).WithField("interface", iface.Name).Warn("Failed to list interface addresses")
 			continue
 		}
 		for _, addr := range addrs {
-			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
-				if ipNet.IP.To4() != nil {
-					ips = append(ips, ipNet.IP.String())
-				}
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil || ipNet.IP.IsLoopback() {
+				continue
+			}
+			mask := ipNet.Mask
+			if ones, _ := mask.Size(); ones < minLocalPrefix {
+				mask = net.CIDRMask(minLocalPrefix, 32)
+			}
+			network := &net.IPNet{IP: ipNet.IP.To4().Mask(mask), Mask: mask}
+			if !seen[network.String()] {
+				seen[network.String()] = true
+				networks = append(networks, network)
 			}
 		}
 	}
-	return ips
+	return networks
 }
 
-func scanNetwork(ip string, devices *[]Device) {
-	defer wg.Done()
-
-	ipRange := getIPRange(ip)
-	var innerWg sync.WaitGroup
+// parseNetworks 解析扫描网段，单个 IP 视为 /32
+func parseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	if len(cidrs) == 0 {
+		networks := localNetworks()
+		if len(networks) == 0 {
+			return nil, errNoNetworks
+		}
+		return networks, nil
+	}
 
-	for _, targetIP := range ipRange {
-		innerWg.Add(1)
-		go func(targetIP string) {
-			defer innerWg.Done()
-			if isPortOpen(targetIP, 80) {
-				device := scanDevice(targetIP)
-				if device != nil {
-					*devices = append(*devices, *device)
-				}
-			}
-		}(targetIP)
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			cidr += "/32"
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		if network.IP.To4() == nil {
+			return nil, fmt.Errorf("%s is not an IPv4 network", cidr)
+		}
+		networks = append(networks, network)
 	}
+	return networks, nil
+}
+
+// networkHosts 返回网段中的主机地址，/31 以上的网段不包含网络地址与广播地址
+func networkHosts(network *net.IPNet) []string {
+	ones, bits := network.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+	start := binary.BigEndian.Uint32(network.IP.To4())
 
-	innerWg.Wait()
+	first, last := uint32(0), size-1
+	if size > 2 {
+		first, last = 1, size-2
+	}
+	hosts := make([]string, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start+i)
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
 }
 
-func getIPRange(ip string) []string {
-	var ips []string
-	// 首先删除最后一位
-	ip = strings.Join(strings.Split(ip, ".")[:3], ".") + "."
-	for i := 1; i <= 254; i++ {
-		ips = append(ips, fmt.Sprintf("%s.%d", ip[:len(ip)-1], i))
+// scanTargets 展开全部需要探测的主机，重复的主机只探测一次
+func scanTargets(networks []*net.IPNet) ([]string, error) {
+	seen := make(map[string]bool)
+	hosts := make([]string, 0)
+	for _, network := range networks {
+		ones, bits := network.Mask.Size()
+		if bits-ones > 16 {
+			return nil, errTooManyHosts
+		}
+		for _, host := range networkHosts(network) {
+			if seen[host] {
+				continue
+			}
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+		if len(hosts) > maxScanHosts {
+			return nil, errTooManyHosts
+		}
 	}
-	return ips
+	return hosts, nil
 }
 
-func isPortOpen(ip string, port int) bool {
-	timeout := time.Second
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, port), timeout)
+func isPortOpen(ctx context.Context, address string, timeout time.Duration) bool {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return false
 	}
@@ -131,51 +242,61 @@ func isPortOpen(ip string, port int) bool {
 	return true
 }
 
-func scanDevice(ip string) *Device {
-	url := fmt.Sprintf("http://%s/metadata", ip)
-	resp, err := http.Get(url)
-	if err == nil {
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
-		if err == nil {
-			var metadata DeviceMetadata
-			if json.Unmarshal(body, &metadata) == nil {
-				logrus.Info("Found device: ", metadata.Metadata.Name)
-				return &Device{
-					IP:          ip,
-					Name:        metadata.Metadata.Name,
-					Description: metadata.Metadata.Description,
-					Version:     metadata.Metadata.Version,
-					Endpoints:   metadata.Entrypoints,
-				}
-			}
-		}
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
 
-	url = fmt.Sprintf("http://%s/data/json", ip)
-	resp, err = http.Get(url)
-	if err == nil {
-		defer resp.Body.Close()
-		body, err := io.ReadAll(resp.Body)
-		if err == nil {
-			var deviceData DeviceData
-			if json.Unmarshal(body, &deviceData) == nil {
-				logrus.Info("Found device: ", ip)
-				return &Device{
-					IP:   ip,
-					Name: ip,
-					Endpoints: []Entrypoint{
-						{
-							Path:        "/data/json",
-							Description: "获取数据",
-							Method:      "GET",
-							Type:        "json",
-						},
-					},
-				}
-			}
-		}
+// fetchMetadata 读取设备的元数据文档
+func fetchMetadata(ctx context.Context, client *http.Client, device *Device, path string) error {
+	var metadata DeviceMetadata
+	if err := getJSON(ctx, client, device.URL(path), &metadata); err != nil {
+		return err
+	}
+	device.Name = metadata.Metadata.Name
+	device.Description = metadata.Metadata.Description
+	device.Version = metadata.Metadata.Version
+	device.Endpoints = metadata.Entrypoints
+	return nil
+}
+
+// probeDevice 读取设备的 /metadata，没有元数据时尝试 /data/json
+func probeDevice(ctx context.Context, client *http.Client, ip string, port int) *Device {
+	device := Device{IP: ip, Port: port}
+
+	if err := fetchMetadata(ctx, client, &device, defaultMetadataPath); err == nil {
+		logrus.Info("Found device: ", device.Name)
+		return &device
 	}
 
+	var deviceData DeviceData
+	if err := getJSON(ctx, client, device.URL("/data/json"), &deviceData); err == nil {
+		logrus.Info("Found device: ", device.Address())
+		device.Name = ip
+		device.Endpoints = []Entrypoint{
+			{
+				Path:        "/data/json",
+				Description: "获取数据",
+				Method:      "GET",
+				Type:        "json",
+			},
+		}
+		return &device
+	}
 	return nil
 }
@@ -5,7 +5,6 @@ import "github.com/mitchellh/mapstructure"
 type SensorData = map[string]float64
 
 type SensorEventPayload struct {
-	SenderID  string `json:"senderID" mapstructure:"senderID"`
 	EventName string `json:"eventName" mapstructure:"eventName"`
 }
 
@@ -16,8 +15,25 @@ func ParseSensorDataPayload(payload map[string]interface{}) *SensorDataPayload {
 }
 
 type SensorDataPayload struct {
-	SenderID string     `json:"senderID" mapstructure:"senderID"`
-	Data     SensorData `json:"data" mapstructure:"data"`
+	Data   SensorData        `json:"data" mapstructure:"data"`
+	Labels map[string]string `json:"labels" mapstructure:"labels"`
+	// 一次采集得到的多组标签不同的指标，例如 Prometheus 指标的全部序列
+	Series []SensorSeries `json:"series" mapstructure:"series"`
+}
+
+// SensorSeries 标签相同的一组指标
+type SensorSeries struct {
+	Labels map[string]string `json:"labels" mapstructure:"labels"`
+	Data   SensorData        `json:"data" mapstructure:"data"`
+}
+
+// AllSeries 返回负载中的全部序列，Data 不为空时以 Data 与 Labels 作为第一组
+func (p *SensorDataPayload) AllSeries() []SensorSeries {
+	series := make([]SensorSeries, 0, len(p.Series)+1)
+	if len(p.Data) > 0 {
+		series = append(series, SensorSeries{Labels: p.Labels, Data: p.Data})
+	}
+	return append(series, p.Series...)
 }
 
 func ParseSensorEventPayload(payload map[string]interface{}) *SensorEventPayload {
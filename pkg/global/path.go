@@ -0,0 +1,127 @@
+package global
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LookupPath 按路径读取 JSON 值中的字段，支持两种写法：
+//
+//	以 . 分隔的路径，数组使用下标：sensors.0.value
+//	以 $ 开头的 JSONPath：$.sensors[0].value、$['device name'].temp、$.values[-1]
+//
+// JSONPath 只支持成员与下标访问，负数下标从数组末尾计算。
+func LookupPath(value interface{}, path string) (interface{}, bool) {
+	keys, ok := splitPath(path)
+	if !ok {
+		return nil, false
+	}
+	for _, key := range keys {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, false
+			}
+			if index < 0 {
+				index += len(v)
+			}
+			if index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// splitPath 将路径拆分为逐级的键
+func splitPath(path string) ([]string, bool) {
+	if path == "" {
+		return nil, true
+	}
+	if !strings.HasPrefix(path, "$") {
+		return strings.Split(path, "."), true
+	}
+
+	keys := make([]string, 0)
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[]")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 || end < len(rest) && rest[end] == ']' {
+				return nil, false
+			}
+			keys = append(keys, rest[:end])
+			rest = rest[end:]
+		case '[':
+			if len(rest) > 1 && (rest[1] == '\'' || rest[1] == '"') {
+				end := strings.IndexByte(rest[2:], rest[1])
+				if end < 0 || !strings.HasPrefix(rest[2+end+1:], "]") {
+					return nil, false
+				}
+				keys = append(keys, rest[2:2+end])
+				rest = rest[2+end+2:]
+				continue
+			}
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, false
+			}
+			key := strings.TrimSpace(rest[1:end])
+			if key == "" {
+				return nil, false
+			}
+			keys = append(keys, key)
+			rest = rest[end+1:]
+		default:
+			return nil, false
+		}
+	}
+	return keys, true
+}
+
+// ToFloat 将数值、布尔值与数值字符串转换为浮点数，ON/OFF 分别视为 1 与 0
+func ToFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		switch strings.ToUpper(v) {
+		case "ON", "TRUE":
+			return 1, true
+		case "OFF", "FALSE":
+			return 0, true
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// PathName 返回路径的最后一级，用作默认的指标名或标签名
+func PathName(path string) string {
+	keys, ok := splitPath(path)
+	if !ok || len(keys) == 0 {
+		return ""
+	}
+	return keys[len(keys)-1]
+}
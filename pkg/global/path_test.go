@@ -0,0 +1,167 @@
+package global
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path string
+		keys []string
+		ok   bool
+	}{
+		{"", nil, true},
+		{"value", []string{"value"}, true},
+		{"sensors.0.value", []string{"sensors", "0", "value"}, true},
+		{"$", []string{}, true},
+		{"$.sensors[0].value", []string{"sensors", "0", "value"}, true},
+		{"$.values[-1]", []string{"values", "-1"}, true},
+		{"$.values[ 2 ]", []string{"values", "2"}, true},
+		{"$['device name'].temp", []string{"device name", "temp"}, true},
+		{`$["pm2.5"]`, []string{"pm2.5"}, true},
+		{"$[0][1]", []string{"0", "1"}, true},
+		{"$['a']['b.c']", []string{"a", "b.c"}, true},
+
+		{"$a", nil, false},
+		{"$.", nil, false},
+		{"$..a", nil, false},
+		{"$.a[0", nil, false},
+		{"$['a'", nil, false},
+		{"$['a'x]", nil, false},
+		{"$.a]", nil, false},
+		{"$.a[]", nil, false},
+		{"$[ ]", nil, false},
+	}
+	for _, tt := range tests {
+		keys, ok := splitPath(tt.path)
+		if ok != tt.ok {
+			t.Errorf("splitPath(%q) ok = %v, want %v", tt.path, ok, tt.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("splitPath(%q) = %q, want %q", tt.path, keys, tt.keys)
+		}
+	}
+}
+
+const lookupDoc = `{
+	"sensors": [
+		{"name": "t1", "value": 21.5},
+		{"name": "t2", "value": 22.5}
+	],
+	"device name": {"temp": 30},
+	"pm2.5": 12,
+	"matrix": [[1, 2], [3, 4]],
+	"empty": [],
+	"nothing": null
+}`
+
+func TestLookupPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(lookupDoc), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		value interface{}
+		ok    bool
+	}{
+		{"sensors.0.value", 21.5, true},
+		{"sensors.1.name", "t2", true},
+		{"$.sensors[0].value", 21.5, true},
+		{"$.sensors[-1].value", 22.5, true},
+		{"$.sensors[-2].name", "t1", true},
+		{"$['device name'].temp", 30.0, true},
+		{`$["pm2.5"]`, 12.0, true},
+		{"$.matrix[1][0]", 3.0, true},
+		{"matrix.0.1", 2.0, true},
+		{"nothing", nil, true},
+
+		// 缺失的键与越界的下标
+		{"missing", nil, false},
+		{"sensors.0.missing", nil, false},
+		{"sensors.2.value", nil, false},
+		{"$.sensors[-3].value", nil, false},
+		{"$.empty[0]", nil, false},
+		{"$.empty[-1]", nil, false},
+		// 类型不匹配
+		{"sensors.first", nil, false},
+		{"sensors.0.value.x", nil, false},
+		{"nothing.x", nil, false},
+		// 不带 $ 时 . 总是分隔符
+		{"pm2.5", nil, false},
+		{"$.", nil, false},
+	}
+	for _, tt := range tests {
+		value, ok := LookupPath(doc, tt.path)
+		if ok != tt.ok {
+			t.Errorf("LookupPath(%q) ok = %v, want %v", tt.path, ok, tt.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(value, tt.value) {
+			t.Errorf("LookupPath(%q) = %v, want %v", tt.path, value, tt.value)
+		}
+	}
+
+	// 空路径与 $ 返回整个值
+	for _, path := range []string{"", "$"} {
+		if value, ok := LookupPath(doc, path); !ok || !reflect.DeepEqual(value, doc) {
+			t.Errorf("LookupPath(%q) did not return the whole document", path)
+		}
+	}
+}
+
+func TestToFloat(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  float64
+		ok    bool
+	}{
+		{21.5, 21.5, true},
+		{true, 1, true},
+		{false, 0, true},
+		{"ON", 1, true},
+		{"off", 0, true},
+		{"True", 1, true},
+		{"FALSE", 0, true},
+		{"12.5", 12.5, true},
+		{"-3e2", -300, true},
+		{"abc", 0, false},
+		{"", 0, false},
+		{nil, 0, false},
+		{map[string]interface{}{}, 0, false},
+		{[]interface{}{1.0}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ToFloat(tt.value)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("ToFloat(%#v) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPathName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"value", "value"},
+		{"ENERGY.Power", "Power"},
+		{"sensors.0.value", "value"},
+		{"$.sensors[0].value", "value"},
+		{"$.values[0]", "0"},
+		{"$['device name']", "device name"},
+		{`$["pm2.5"]`, "pm2.5"},
+		{"", ""},
+		{"$", ""},
+		{"$.", ""},
+	}
+	for _, tt := range tests {
+		if got := PathName(tt.path); got != tt.want {
+			t.Errorf("PathName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}